@@ -3,8 +3,10 @@ package dicebot
 import (
 	"errors"
 	"fmt"
-	"regexp"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 func EscapeMarkdown(input string) string {
@@ -15,8 +17,16 @@ func EscapeMarkdown(input string) string {
 }
 
 type Bot struct {
-	db    Database
-	moves map[string]Move
+	db          Database
+	moves       map[string]Move
+	movesMutex  sync.RWMutex
+	tables      map[string]Table
+	tablesMutex sync.RWMutex
+	// uploads caches the parsed files uploaded for each server, by scope.
+	uploads      map[string][]interface{}
+	uploadsMutex sync.Mutex
+	permissions  Permissions
+	limits       Limits
 }
 
 type MessageContext struct {
@@ -24,32 +34,149 @@ type MessageContext struct {
 	UserName  string
 	ChannelId string
 	ServerId  string
+	// MessageId is the ID of the message that contains the command, if any.
+	MessageId   string
+	Roles       []string
+	Permissions int64
+	// BotName is the name of the bot, as it appears in messages that mention the bot.
+	BotName string
+	// Attachments downloads the files attached to the message. It is only called by commands
+	// that use attachments.
+	Attachments func() ([]Attachment, error)
+	// Mentions maps the users mentioned in the message, as they appear in the text (`@Name`),
+	// to their IDs.
+	Mentions map[string]string
 }
 
-func NewBot(dbFile string) (*Bot, error) {
-	db, err := NewJsonDatabase(dbFile)
-	if err != nil {
-		return nil, err
+type Option func(bot *Bot) error
+
+// WithDatabase makes the bot store variables in db.
+func WithDatabase(db Database) Option {
+	return func(bot *Bot) error {
+		bot.db = db
+		return nil
 	}
+}
 
-	return &Bot{db: db, moves: make(map[string]Move)}, nil
+// WithDatabaseFile makes the bot store variables in a JSON file.
+func WithDatabaseFile(filename string) Option {
+	return func(bot *Bot) error {
+		db, err := NewJsonDatabase(filename)
+		if err != nil {
+			return err
+		}
+		bot.db = db
+		return nil
+	}
+}
+
+func WithPermissions(permissions Permissions) Option {
+	return func(bot *Bot) error {
+		bot.permissions = permissions
+		return nil
+	}
+}
+
+func WithLimits(limits Limits) Option {
+	return func(bot *Bot) error {
+		bot.limits = limits
+		return nil
+	}
+}
+
+// NewBot creates a bot with the default permissions and limits. Without a database option,
+// variables are only kept in memory.
+func NewBot(options ...Option) (*Bot, error) {
+	bot := &Bot{moves: make(map[string]Move), tables: make(map[string]Table), permissions: DefaultPermissions(), limits: DefaultLimits()}
+
+	for _, option := range options {
+		if err := option(bot); err != nil {
+			return nil, err
+		}
+	}
+
+	if bot.db == nil {
+		db, err := NewMemoryDatabase("", 0)
+		if err != nil {
+			return nil, err
+		}
+		bot.db = db
+	}
+
+	return bot, nil
+}
+
+func (bot *Bot) Close() error {
+	return bot.db.Close()
 }
 
 func (bot *Bot) LoadMoves(filename string) error {
+	bot.movesMutex.Lock()
+	defer bot.movesMutex.Unlock()
+
 	return LoadMoves(bot.moves, filename)
 }
 
-func (bot *Bot) Usage() string {
-	return "Type `!roll d<x>` to roll a *x*-sided die\n" +
-		"Type `!roll <n>d<x>` to roll any number of *x*-sided dice (`!roll 3d6` rolls three regular six-sided dice)\n" +
-		"You can use simple mathematical expressions too. For example, `d20 + 4` rolls a twenty-sided dice and adds four to the result.\n" +
-		"The bot understands addition, subtraction, multiplication, division and brackets.\n" +
-		"Type `!save <expr> as <name>` to save an expression. For example you could `!save 2d6+1 as str` and use `!roll str` later.\n" +
-		"Type `!move` to get a list of moves, and `!move <name>` to make a move."
+// ReloadMoves replaces all moves with the moves in the files. If any of the files can't be
+// loaded, the moves are not changed.
+func (bot *Bot) ReloadMoves(filenames ...string) error {
+	moves := make(map[string]Move)
+	for _, filename := range filenames {
+		if err := LoadMoves(moves, filename); err != nil {
+			return err
+		}
+	}
+
+	bot.movesMutex.Lock()
+	defer bot.movesMutex.Unlock()
+
+	bot.moves = moves
+	return nil
+}
+
+func (bot *Bot) LoadTables(filename string) error {
+	bot.tablesMutex.Lock()
+	defer bot.tablesMutex.Unlock()
+
+	return LoadTables(bot.tables, filename)
+}
+
+// ReloadTables replaces all tables with the tables in the files. If any of the files can't be
+// loaded, the tables are not changed.
+func (bot *Bot) ReloadTables(filenames ...string) error {
+	tables := make(map[string]Table)
+	for _, filename := range filenames {
+		if err := LoadTables(tables, filename); err != nil {
+			return err
+		}
+	}
+
+	bot.tablesMutex.Lock()
+	defer bot.tablesMutex.Unlock()
+
+	bot.tables = tables
+	return nil
+}
+
+func (context MessageContext) scopes() []string {
+	return []string{"user-" + context.UserId, "channel-" + context.ChannelId, "server-" + context.ServerId}
+}
+
+func (context MessageContext) scope(for_ string) (string, error) {
+	switch for_ {
+	case "server":
+		return "server-" + context.ServerId, nil
+	case "channel":
+		return "channel-" + context.ChannelId, nil
+	case "", "me", "user":
+		return "user-" + context.UserId, nil
+	default:
+		return "", errors.New("undefined scope " + for_)
+	}
 }
 
 func (bot *Bot) LookupVariable(context MessageContext, name string) (Expr, error) {
-	for _, scope := range []string{"user-" + context.UserId, "channel-" + context.ChannelId, "server-" + context.ServerId} {
+	for _, scope := range context.scopes() {
 		value, found := bot.db.ReadValue(strings.ToLower(name), scope)
 		if found {
 			return ParseString(value)
@@ -89,85 +216,319 @@ func (bot *Bot) FormatResult(input string, value int, explanation string) string
 	return s
 }
 
-func (bot *Bot) RollDice(context MessageContext, input string) string {
-	value, explanation, err := bot.Eval(context, input)
+// expression is a single expression in input that contains several expressions. Offset is
+// the position of the expression in the input, in runes.
+type expression struct {
+	Text   string
+	Offset int
+}
 
-	if err != nil {
-		return bot.HandleError(input, err)
+// splitExpressions splits input on semicolons and newlines.
+func splitExpressions(input string) []expression {
+	var expressions []expression
+
+	runes := []rune(input)
+	start := 0
+	for i := 0; i <= len(runes); i += 1 {
+		if i < len(runes) && runes[i] != ';' && runes[i] != '\n' {
+			continue
+		}
+
+		part := runes[start:i]
+		leading := 0
+		for leading < len(part) && unicode.IsSpace(part[leading]) {
+			leading += 1
+		}
+		if text := strings.TrimSpace(string(part)); text != "" {
+			expressions = append(expressions, expression{text, start + leading})
+		}
+		start = i + 1
+	}
+
+	return expressions
+}
+
+// RollDice evaluates one or more expressions, separated by semicolons or newlines.
+//
+// A pending forward bonus is added to the roll if there is just one expression.
+func (bot *Bot) RollDice(context MessageContext, input string) Response {
+	header, text, roll := "", input, bot.roll
+	if expressions := splitExpressions(input); len(expressions) == 1 {
+		var bonuses string
+		if text, bonuses = bot.withBonuses(context, expressions[0].Text, false); bonuses != "" {
+			header = "Including " + bonuses + ":\n"
+			roll = func(context MessageContext, withBonuses string) (int, string, error) {
+				return bot.rollWithBonuses(context, expressions[0].Text, withBonuses)
+			}
+		}
+	}
+
+	results := bot.rollExpressions(context, text, roll)
+	if header != "" && results[0].Error == "" {
+		bot.useForward(context)
+	} else {
+		header = ""
 	}
 
-	return bot.FormatResult(input, value, explanation)
+	response := bot.resultResponse(header, results)
+	response.ReplyTo = context.MessageId
+	response.Buttons = rollButtons(input)
+	return response
+}
+
+// rollResult is the result of rolling a single expression. If the expression could not be
+// evaluated, Error is the message to show instead.
+type rollResult struct {
+	Input       string
+	Value       int
+	Explanation string
+	Error       string
+}
+
+// rollExpressions evaluates every expression in the input with the roll function.
+func (bot *Bot) rollExpressions(context MessageContext, input string, roll func(MessageContext, string) (int, string, error)) []rollResult {
+	expressions := splitExpressions(input)
+	if len(expressions) == 0 {
+		return []rollResult{{Input: input, Error: bot.HandleError(input, ParseError{"Empty input", 0})}}
+	}
+
+	results := make([]rollResult, len(expressions))
+	for i, expression := range expressions {
+		value, explanation, err := roll(context, expression.Text)
+		results[i] = rollResult{Input: expression.Text, Value: value, Explanation: explanation}
+		if parseError, ok := err.(ParseError); ok {
+			parseError.Position += expression.Offset
+			results[i].Error = bot.HandleError(input, parseError)
+		} else if err != nil {
+			results[i].Error = bot.HandleError(expression.Text, err)
+		}
+	}
+	return results
+}
+
+// formatResults formats results one per line. If keep is not zero, explanations are
+// abbreviated to keep rolls per list.
+func (bot *Bot) formatResults(results []rollResult, keep int) string {
+	lines := make([]string, len(results))
+	for i, result := range results {
+		if result.Error != "" {
+			lines[i] = result.Error
+		} else if keep > 0 {
+			lines[i] = bot.FormatResult(result.Input, result.Value, AbbreviateExplanation(result.Explanation, keep))
+		} else {
+			lines[i] = bot.FormatResult(result.Input, result.Value, result.Explanation)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resultResponse creates a response with results, after header. If the response would be
+// too long, the explanations are abbreviated, and the full explanations are attached.
+func (bot *Bot) resultResponse(header string, results []rollResult) Response {
+	response := Response{Content: header + bot.formatResults(results, 0)}
+	if len(response.Content) <= MaxResponseLength {
+		return response
+	}
+
+	var lines []string
+	for _, result := range results {
+		if result.Error == "" {
+			lines = append(lines, fmt.Sprintf("%s => %s => %d", result.Input, result.Explanation, result.Value))
+		}
+	}
+	response.Content = header + bot.formatResults(results, AbbreviatedRolls)
+	response.Attachments = []Attachment{{Name: "rolls.txt", Content: strings.Join(lines, "\n") + "\n"}}
+	return response
+}
+
+func (context MessageContext) session() string {
+	return "channel-" + context.ChannelId
+}
+
+// parseUntil parses when a saved value should expire. This is either a duration, like "1h"
+// or "30m", or the end of the current session.
+func parseUntil(context MessageContext, until string, now time.Time) (expires time.Time, session string, err error) {
+	switch strings.ToLower(until) {
+	case "":
+		return
+	case "session end", "end of session", "the end of the session", "session":
+		session = context.session()
+		return
+	}
+
+	duration, err := time.ParseDuration(until)
+	if err != nil || duration <= 0 {
+		err = errors.New(fmt.Sprintf("invalid duration `%s`", until))
+		return
+	}
+	expires = now.Add(duration)
+	return
 }
 
 func (bot *Bot) Save(context MessageContext, input, name, for_ string) error {
-	_, err := ParseString(input)
+	return bot.SaveUntil(context, input, name, for_, "")
+}
+
+// SaveUntil saves an expression that expires after a duration, or at the end of the session.
+func (bot *Bot) SaveUntil(context MessageContext, input, name, for_, until string) error {
+	if err := bot.checkLength(input); err != nil {
+		return err
+	}
+
+	expr, err := ParseString(input)
 	if err != nil {
 		return err
 	}
 
-	scope := ""
-	switch for_ {
-	case "server":
-		scope = "server-" + context.ServerId
-	case "channel":
-		scope = "channel-" + context.ChannelId
-	case "", "me", "user":
-		scope = "user-" + context.UserId
-	default:
-		return errors.New("undefined scope " + for_)
+	if err := bot.checkSize(expr); err != nil {
+		return err
 	}
 
-	return bot.db.StoreValue(strings.ToLower(name), scope, input)
-}
+	scope, err := context.scope(for_)
+	if err != nil {
+		return err
+	}
 
-func (bot *Bot) HandleError(command string, err error) string {
-	s := fmt.Sprintf("Sorry, I don't understand how to parse '%s'", EscapeMarkdown(command))
+	if err := bot.checkPermission(context, scope); err != nil {
+		return err
+	}
 
-	if err == nil {
-		return s
+	name = strings.ToLower(name)
+	if err := bot.checkQuota(name, scope); err != nil {
+		return err
 	}
 
-	if parseError, ok := err.(ParseError); ok {
-		return s + fmt.Sprintf("\n```\n%s\n%s^-- %s\n```", command, strings.Repeat(" ", parseError.Position), parseError.Message)
+	now := time.Now()
+	expires, session, err := parseUntil(context, until, now)
+	if err != nil {
+		return err
 	}
 
-	return s + ": " + err.Error()
+	revision := Revision{Value: input, Author: context.UserName, Time: now, Expires: expires, Session: session}
+	return bot.db.StoreRevision(name, scope, revision)
 }
 
-func (bot *Bot) HandleMessage(context MessageContext, msg string) string {
-	msg = strings.TrimSpace(msg)
-	if msg == "!roll" || msg == "!roll help" || msg == "!save" || msg == "!save help" {
-		return bot.Usage()
+// findScope returns the scope a variable is stored in. Without an explicit scope this is
+// the first scope LookupVariable would find the variable in.
+func (bot *Bot) findScope(context MessageContext, name, for_ string) (string, error) {
+	scopes := context.scopes()
+	if for_ != "" {
+		scope, err := context.scope(for_)
+		if err != nil {
+			return "", err
+		}
+		scopes = []string{scope}
 	}
 
-	if strings.Index(msg, "!roll ") == 0 {
-		return bot.RollDice(context, strings.TrimSpace(msg[6:]))
+	for _, scope := range scopes {
+		if _, found := bot.db.ReadValue(name, scope); found {
+			return scope, nil
+		}
 	}
 
-	if strings.Index(msg, "!save ") == 0 {
-		r := regexp.MustCompile(`\A!save\s+(.*)\s+as\s+(\w+)(\s+for\s+(\w+))?\z`)
-		match := r.FindStringSubmatch(msg)
-		if match == nil {
-			return bot.HandleError(msg[1:], nil)
+	return "", errors.New(fmt.Sprintf("undefined variable `%s`", name))
+}
+
+func (bot *Bot) History(context MessageContext, name, for_ string) (string, error) {
+	name = strings.ToLower(name)
+	scope, err := bot.findScope(context, name, for_)
+	if err != nil {
+		return "", err
+	}
+
+	history := bot.db.ReadHistory(name, scope)
+	if len(history) == 0 {
+		return "", errors.New(fmt.Sprintf("undefined variable `%s`", name))
+	}
+
+	s := fmt.Sprintf("History of `%s`:\n", name)
+	for i, revision := range history {
+		s += " * **" + EscapeMarkdown(revision.Value) + "**"
+		if revision.Author != "" {
+			s += " by " + EscapeMarkdown(revision.Author)
 		}
-		err := bot.Save(context, match[1], match[2], match[4])
-		if err != nil {
-			return bot.HandleError(msg[1:], err)
+		if !revision.Time.IsZero() {
+			s += " on " + revision.Time.UTC().Format("2006-01-02 15:04")
+		}
+		if i == 0 {
+			s += " (current)"
 		}
-		return fmt.Sprintf("Saved **%s** as `%s`", match[1], match[2])
+		s += "\n"
+	}
+	return s, nil
+}
+
+func (bot *Bot) Undo(context MessageContext, name, for_ string) (string, error) {
+	name = strings.ToLower(name)
+	scope, err := bot.findScope(context, name, for_)
+	if err != nil {
+		return "", err
+	}
+
+	if err := bot.checkPermission(context, scope); err != nil {
+		return "", err
+	}
+
+	revision, found, err := bot.db.UndoValue(name, scope)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return fmt.Sprintf("Removed `%s`", name), nil
+	}
+	return fmt.Sprintf("Restored `%s` to **%s**", name, EscapeMarkdown(revision.Value)), nil
+}
+
+// EndSession removes all values that were saved until the end of the session in this channel.
+// This includes values other users saved, so it needs permission to change channel variables.
+func (bot *Bot) EndSession(context MessageContext) string {
+	if err := bot.checkRule(context, "channel", "end the session"); err != nil {
+		return bot.HandleError("session end", err)
+	}
+
+	removed, err := bot.db.EndSession(context.session())
+	if err != nil {
+		return bot.HandleError("session end", err)
+	}
+	if removed == 1 {
+		return "Session ended, removed 1 temporary expression."
 	}
+	return fmt.Sprintf("Session ended, removed %d temporary expressions.", removed)
+}
 
-	if msg == "!move" {
-		response := "I know the following moves:\n"
-		for _, move := range bot.moves {
-			response += " * " + EscapeMarkdown(move.Name) + "\n"
+// errorLine returns the line of a command that contains position, and the column of position
+// in that line. Both position and column are counted in runes.
+func errorLine(command string, position int) (string, int) {
+	lines := strings.Split(command, "\n")
+	for _, line := range lines {
+		length := len([]rune(line))
+		if position <= length {
+			return line, position
 		}
-		return response
+		position -= length + 1
+	}
+
+	// The position is past the end of the command.
+	line := lines[len(lines)-1]
+	return line, len([]rune(line))
+}
+
+func (bot *Bot) HandleError(command string, err error) string {
+	switch err.(type) {
+	case PermissionError, LimitError:
+		return "Sorry, " + err.Error()
+	}
+
+	s := fmt.Sprintf("Sorry, I don't understand how to parse '%s'", EscapeMarkdown(command))
+
+	if err == nil {
+		return s
 	}
 
-	if strings.Index(msg, "!move ") == 0 {
-		return bot.MakeMove(context, strings.TrimSpace(msg[6:]))
+	if parseError, ok := err.(ParseError); ok {
+		line, column := errorLine(command, parseError.Position)
+		return s + fmt.Sprintf("\n```\n%s\n%s^-- %s\n```", line, strings.Repeat(" ", column), parseError.Message)
 	}
 
-	return ""
+	return s + ": " + err.Error()
 }
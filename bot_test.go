@@ -3,7 +3,10 @@ package dicebot
 import (
 	"fmt"
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 var bot = &Bot{
@@ -18,7 +21,29 @@ var context = MessageContext{
 }
 
 func handleMessage(msg string) string {
-	return bot.HandleMessage(context, msg)
+	return bot.HandleMessage(context, msg).String()
+}
+
+func TestNewBot(t *testing.T) {
+	bot, err := NewBot()
+	if err != nil {
+		t.Fatalf("NewBot(): %v", err)
+	}
+	if _, ok := bot.db.(*MemoryDatabase); !ok {
+		t.Errorf("NewBot() should use a memory database, got %T", bot.db)
+	}
+	if err := bot.Close(); err != nil {
+		t.Errorf("Close(): %v", err)
+	}
+
+	db := &JsonDatabase{}
+	bot, err = NewBot(WithDatabase(db), WithLimits(Limits{}))
+	if err != nil {
+		t.Fatalf("NewBot(): %v", err)
+	}
+	if bot.db != db || bot.limits.ExpressionLength != 0 {
+		t.Errorf("NewBot() ignored options")
+	}
 }
 
 func ExampleEscapeMarkdown() {
@@ -109,6 +134,62 @@ func ExampleBot_HandleMessage_recursive() {
 	// ```
 }
 
+func ExampleBot_HandleMessage_history() {
+	rand.Seed(1)
+	bot.db.StoreRevision("hist", "user-user", Revision{Value: "d6", Author: "Player", Time: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)})
+	bot.db.StoreRevision("hist", "user-user", Revision{Value: "d8", Author: "Other", Time: time.Date(2020, 1, 3, 3, 4, 5, 0, time.UTC)})
+	fmt.Println(handleMessage("!history hist"))
+	fmt.Println(handleMessage("!undo hist"))
+	fmt.Println(handleMessage("!roll hist"))
+	fmt.Println(handleMessage("!undo hist"))
+	fmt.Println(handleMessage("!history hist"))
+	// Output:
+	// History of `hist`:
+	//  * **d8** by Other on 2020-01-03 03:04 (current)
+	//  * **d6** by Player on 2020-01-02 03:04
+	//
+	// Restored `hist` to **d6**
+	// hist => **6**
+	// Removed `hist`
+	// Sorry, I don't understand how to parse 'history hist': undefined variable `hist`
+}
+
+func ExampleBot_HandleMessage_historyScope() {
+	fmt.Println(handleMessage("!save 7 as scoped for channel"))
+	fmt.Println(handleMessage("!undo scoped for me"))
+	fmt.Println(handleMessage("!undo scoped for channel"))
+	// Output:
+	// Saved **7** as `scoped`
+	// Sorry, I don't understand how to parse 'undo scoped for me': undefined variable `scoped`
+	// Removed `scoped`
+}
+
+func ExampleBot_HandleMessage_saveUntil() {
+	fmt.Println(handleMessage("!save 4 as bless for me until session end"))
+	fmt.Println(handleMessage("!save 2 as rage until 1h"))
+	fmt.Println(handleMessage("!roll bless + rage"))
+	fmt.Println(handleMessage("!session end"))
+	fmt.Println(handleMessage("!roll bless"))
+	fmt.Println(handleMessage("!save 2 as rage until tomorrow"))
+	// Output:
+	// Saved **4** as `bless` until session end
+	// Saved **2** as `rage` until 1h
+	// bless + rage => **4 + 2** => **6**
+	// Session ended, removed 1 temporary expression.
+	// Sorry, I don't understand how to parse 'bless': undefined variable `bless`
+	// Sorry, I don't understand how to parse 'save 2 as rage until tomorrow': invalid duration `tomorrow`
+}
+
+func TestBot_LookupVariable_Expired(t *testing.T) {
+	bot.db.StoreRevision("expired", "user-user", Revision{Value: "1", Expires: time.Now().Add(-time.Minute)})
+	bot.db.StoreRevision("expired", "server-server", Revision{Value: "2"})
+
+	expr, err := bot.LookupVariable(context, "expired")
+	if err != nil || expr.String() != "2" {
+		t.Errorf("LookupVariable() should ignore expired values, got %v %v", expr, err)
+	}
+}
+
 func TestBot_LookupVariable_Scope(t *testing.T) {
 	bot.Save(context, "1", "v1", "user")
 	_, err := bot.LookupVariable(context, "v1")
@@ -168,9 +249,79 @@ func ExampleBot_HandleMessage_error3() {
 	// Sorry, I don't understand how to parse 'x': undefined variable `x`
 }
 
+func ExampleBot_HandleMessage_multiple() {
+	rand.Seed(1)
+	fmt.Println(handleMessage("!roll d20+5; 2d6+3;d4"))
+	fmt.Println(handleMessage("!roll d20\n 2d6"))
+	// Output:
+	// d20+5 => **2 + 5** => **7**
+	// 2d6+3 => **(4 + 6) + 3** => **13**
+	// d4 => **4**
+	// d20 => **2**
+	// 2d6 => **(1 + 2)** => **3**
+}
+
+func ExampleBot_HandleMessage_multipleError() {
+	rand.Seed(1)
+	fmt.Println(handleMessage("!roll d20+5;  2d6**3; d4"))
+	fmt.Println(handleMessage("!roll d6\nd20 +\nunknown"))
+	// Output:
+	// d20+5 => **2 + 5** => **7**
+	// Sorry, I don't understand how to parse 'd20+5;  2d6\*\*3; d4'
+	// ```
+	// d20+5;  2d6**3; d4
+	//             ^-- Unexpected input
+	// ```
+	// d4 => **4**
+	// d6 => **6**
+	// Sorry, I don't understand how to parse 'd6
+	// d20 +
+	// unknown'
+	// ```
+	// d20 +
+	//      ^-- Unexpected input
+	// ```
+	// Sorry, I don't understand how to parse 'unknown': undefined variable `unknown`
+}
+
+func TestSplitExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []expression
+	}{
+		{"d6", []expression{{"d6", 0}}},
+		{" d6 ; 2d6", []expression{{"d6", 1}, {"2d6", 6}}},
+		{"d6\n\n€;d8", []expression{{"d6", 0}, {"€", 4}, {"d8", 6}}},
+		{" ; ", nil},
+	}
+
+	for _, test := range tests {
+		expressions := splitExpressions(test.input)
+		if !reflect.DeepEqual(expressions, test.expected) {
+			t.Errorf("splitExpressions(%q) got %v expected %v", test.input, expressions, test.expected)
+		}
+	}
+}
+
 func TestBot_HandleMessage_IgnoreUnknown(t *testing.T) {
 	got := handleMessage("!foo")
 	if got != "" {
 		t.Errorf("HandleMessage should ignore unknown commands, got %v", got)
 	}
 }
+
+func TestBot_RollDice_long(t *testing.T) {
+	bot := &Bot{db: &JsonDatabase{}}
+	input := strings.Repeat("100d6;", 6)
+
+	response := bot.RollDice(context, input)
+	if len(response.Content) > MaxResponseLength {
+		t.Errorf("RollDice(%q): response is %d characters long", input, len(response.Content))
+	}
+	if !strings.Contains(response.Content, "… 90 more)") {
+		t.Errorf("RollDice(%q): expected abbreviated explanation, got %q", input, response.Content)
+	}
+	if len(response.Attachments) != 1 || strings.Count(response.Attachments[0].Content, "100d6 => (") != 6 {
+		t.Errorf("RollDice(%q): expected full explanation as attachment, got %+v", input, response.Attachments)
+	}
+}
@@ -0,0 +1,73 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxActionLength is the longest action a button can have.
+const MaxActionLength = 100
+
+// rollButtons returns the buttons shown below the result of rolling input.
+func rollButtons(input string) []Button {
+	if len("distribution:"+input) > MaxActionLength {
+		return nil
+	}
+	return []Button{
+		{Label: "Roll again", Action: "roll:" + input},
+		{Label: "Roll with advantage", Action: "advantage:" + input},
+		{Label: "Show distribution", Action: "distribution:" + input},
+	}
+}
+
+// rollWithAdvantage rolls an expression twice, and keeps the highest result.
+func (bot *Bot) rollWithAdvantage(context MessageContext, input string) (value int, explanation string, err error) {
+	first, _, err := bot.Eval(context, input)
+	if err != nil {
+		return
+	}
+	second, _, err := bot.Eval(context, input)
+	if err != nil {
+		return
+	}
+
+	if first >= second {
+		value, explanation = first, fmt.Sprintf("best of (__%d__, %d)", first, second)
+	} else {
+		value, explanation = second, fmt.Sprintf("best of (%d, __%d__)", first, second)
+	}
+	bot.logRoll(context, input, value, explanation)
+	return
+}
+
+// RollWithAdvantage rolls every expression in input twice, and keeps the highest result.
+func (bot *Bot) RollWithAdvantage(context MessageContext, input string) Response {
+	response := bot.resultResponse(EscapeMarkdown(context.UserName)+" rolls with advantage:\n", bot.rollExpressions(context, input, bot.rollWithAdvantage))
+	response.Buttons = rollButtons(input)
+	return response
+}
+
+// HandleButton runs the action of a button that was pressed.
+func (bot *Bot) HandleButton(context MessageContext, action string) Responses {
+	name, input := action, ""
+	if i := strings.Index(action, ":"); i >= 0 {
+		name, input = action[:i], action[i+1:]
+	}
+
+	switch name {
+	case "roll":
+		response := bot.RollDice(context, input)
+		response.Content = EscapeMarkdown(context.UserName) + " rolls again:\n" + response.Content
+		return Responses{response}
+	case "advantage":
+		return Responses{bot.RollWithAdvantage(context, input)}
+	case "distribution":
+		var lines []string
+		for _, expression := range splitExpressions(input) {
+			lines = append(lines, bot.ShowDistribution(context, expression.Text))
+		}
+		return Responses{{Content: strings.Join(lines, "\n"), Visibility: Private, Recipients: []string{context.UserId}}}
+	}
+	return reply(bot.HandleError(action, errors.New("unknown button")))
+}
@@ -0,0 +1,35 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+)
+
+func ExampleBot_HandleButton() {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}}
+
+	response := bot.RollDice(context, "d20+2")
+	fmt.Println(response)
+	for _, button := range response.Buttons {
+		fmt.Printf("%s: %s\n", button.Label, button.Action)
+	}
+
+	fmt.Println(bot.HandleButton(context, "roll:d20+2"))
+	fmt.Println(bot.HandleButton(context, "advantage:d20+2"))
+	distribution := bot.HandleButton(context, "distribution:d20+2")[0]
+	fmt.Println(distribution.Visibility, distribution.Recipients, strings.Split(distribution.Content, "\n")[0])
+	fmt.Println(bot.HandleButton(context, "frobnicate"))
+	// Output:
+	// d20+2 => **2 + 2** => **4**
+	// Roll again: roll:d20+2
+	// Roll with advantage: advantage:d20+2
+	// Show distribution: distribution:d20+2
+	// Player rolls again:
+	// d20+2 => **8 + 2** => **10**
+	// Player rolls with advantage:
+	// d20+2 => **best of (10, __22__)** => **22**
+	// 1 [user] Distribution of d20+2 (average 12.50):
+	// Sorry, I don't understand how to parse 'frobnicate': unknown button
+}
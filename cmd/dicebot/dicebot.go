@@ -1,11 +1,16 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/signal"
+	"path"
 	"strings"
+	"syscall"
 
 	"github.com/bwmarrin/discordgo"
 	"github.com/hackedd/dicebot"
@@ -30,21 +35,76 @@ func onReady(s *discordgo.Session, event *discordgo.Ready) {
 }
 
 func onMessageCreate(s *discordgo.Session, m *discordgo.MessageCreate) {
-	handleMessage(s, m.Message)
+	logMessage(s, discordgo.LogDebug, "Received message event: %+v", m.Message)
+
+	context, ok := messageContext(s, m.Message)
+	if !ok {
+		return
+	}
+
+	responses := bot.HandleMessage(context, m.ContentWithMentionsReplaced())
+	if len(responses) == 0 {
+		// Only messages with replies are tracked, so chatter doesn't push them out. Messages
+		// that are edited into a command are handled like new ones.
+		return
+	}
+	replyIDs := sendResponses(s, m.ChannelID, context.ServerId, responses, nil)
+	replies.set(m.ID, trackedMessage{
+		Content:     m.Content,
+		Reply:       responses.String(),
+		ReplyIDs:    replyIDs,
+		Attachments: hasAttachments(responses),
+	})
 }
 
 func onMessageUpdate(s *discordgo.Session, m *discordgo.MessageUpdate) {
-	handleMessage(s, m.Message)
-}
+	logMessage(s, discordgo.LogDebug, "Received message update event: %+v", m.Message)
+
+	// Updates that only add embeds for links don't include the content.
+	if m.Content == "" {
+		return
+	}
+	tracked, found := replies.get(m.ID)
+	if found && tracked.Content == m.Content {
+		return
+	}
 
-func handleMessage(s *discordgo.Session, m *discordgo.Message) {
-	logMessage(s, discordgo.LogDebug, "Received message event: %+v", m)
+	context, ok := messageContext(s, m.Message)
+	if !ok {
+		return
+	}
 
-	if m.Author == nil || s.State == nil || s.State.User == nil || m.Author.ID == s.State.User.ID {
+	responses := bot.HandleEdit(context, m.ContentWithMentionsReplaced(), tracked.Reply)
+	if len(responses) == 0 {
 		return
 	}
 
-	msg := strings.Replace(m.ContentWithMentionsReplaced(), s.State.User.Username, "username", 1)
+	edit := tracked.ReplyIDs
+	if tracked.Attachments || hasAttachments(responses) {
+		// Editing a message can't remove or replace its attachments, so the replies are sent
+		// again instead of leaving the files of the old result.
+		deleteMessages(s, m.ChannelID, edit)
+		edit, tracked.ReplyIDs = nil, nil
+	}
+
+	replyIDs := sendResponses(s, m.ChannelID, context.ServerId, responses, edit)
+	if tracked.Reply == "" {
+		tracked.Reply = responses.String()
+	}
+	tracked.Content = m.Content
+	tracked.Attachments = hasAttachments(responses)
+	if len(replyIDs) > 0 {
+		tracked.ReplyIDs = replyIDs
+	}
+	replies.set(m.ID, tracked)
+}
+
+// messageContext creates the context for a message. It returns false if the bot should not
+// respond to the message.
+func messageContext(s *discordgo.Session, m *discordgo.Message) (dicebot.MessageContext, bool) {
+	if m.Author == nil || s.State == nil || s.State.User == nil || m.Author.ID == s.State.User.ID {
+		return dicebot.MessageContext{}, false
+	}
 
 	channel, err := s.State.Channel(m.ChannelID)
 	if err != nil {
@@ -57,67 +117,241 @@ func handleMessage(s *discordgo.Session, m *discordgo.Message) {
 		UserName:  m.Author.Username,
 		ChannelId: m.ChannelID,
 		ServerId:  channel.GuildID,
+		MessageId: m.ID,
+		BotName:   s.State.User.Username,
 	}
 
-	response := bot.HandleMessage(context, msg)
-	if response != "" {
-		if len(response) < 2000 {
-			_, err = s.ChannelMessageSend(m.ChannelID, response)
-		} else {
-			_, err = s.ChannelMessageSend(m.ChannelID, "Sorry, the result of your command is too long. Try rolling fewer dice.")
+	if m.Member != nil {
+		context.Roles = roleNames(s, channel.GuildID, m.Member.Roles)
+	}
+	// Commands get the content with mentions replaced by names, see ContentWithMentionsReplaced.
+	if len(m.Mentions) > 0 {
+		context.Mentions = make(map[string]string, len(m.Mentions))
+		for _, user := range m.Mentions {
+			context.Mentions["@"+user.Username] = user.ID
+		}
+	}
+	if permissions, err := s.State.MessagePermissions(m); err == nil {
+		context.Permissions = permissions
+	}
+	// Attachments are only downloaded by the commands that upload files.
+	attachments := m.Attachments
+	context.Attachments = func() ([]dicebot.Attachment, error) {
+		return downloadAttachments(s, attachments)
+	}
+	return context, true
+}
+
+// downloadAttachments downloads the attachments of a message that could be move or table files.
+func downloadAttachments(s *discordgo.Session, attachments []*discordgo.MessageAttachment) ([]dicebot.Attachment, error) {
+	var downloaded []dicebot.Attachment
+	for _, attachment := range attachments {
+		switch strings.ToLower(path.Ext(attachment.Filename)) {
+		case ".json", ".yaml", ".yml", ".toml":
+		default:
+			continue
+		}
+		if attachment.Size > dicebot.MaxUploadSize {
+			return nil, errors.New(fmt.Sprintf("%s is larger than %d bytes", attachment.Filename, dicebot.MaxUploadSize))
+		}
+
+		content, err := download(s, attachment.URL)
+		if err != nil {
+			logMessage(s, discordgo.LogError, "Unable to download attachment %s: %s", attachment.URL, err)
+			return nil, errors.New(fmt.Sprintf("unable to download %s", attachment.Filename))
+		}
+		downloaded = append(downloaded, dicebot.Attachment{Name: attachment.Filename, Content: content})
+	}
+	return downloaded, nil
+}
+
+// download downloads a file of at most dicebot.MaxUploadSize bytes.
+func download(s *discordgo.Session, url string) (string, error) {
+	response, err := s.Client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return "", errors.New(fmt.Sprintf("unexpected status %s", response.Status))
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(response.Body, dicebot.MaxUploadSize+1))
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+// sendResponses sends responses to a channel, and private responses to their recipients. The
+// public responses replace the messages with IDs in edit, as far as there are any, and the
+// messages that are left over are deleted. It returns the IDs of the public messages.
+func sendResponses(s *discordgo.Session, channelID, guildID string, responses dicebot.Responses, edit []string) []string {
+	var messageIDs []string
+	failed := false
+	for _, response := range responses {
+		if response.Visibility == dicebot.Private {
+			sendPrivate(s, guildID, response, "")
+			continue
+		}
+		for _, page := range pages(response) {
+			var message *discordgo.Message
+			var err error
+			if len(messageIDs) < len(edit) {
+				message, err = s.ChannelMessageEditComplex(messageEdit(channelID, edit[len(messageIDs)], page))
+			} else {
+				message, err = s.ChannelMessageSendComplex(channelID, messageSend(channelID, page))
+			}
+			if err != nil {
+				logMessage(s, discordgo.LogError, "Unable to send message to %s: %s", channelID, err)
+				failed = true
+				break
+			}
+			messageIDs = append(messageIDs, message.ID)
+		}
+	}
+	if !failed && len(messageIDs) < len(edit) {
+		deleteMessages(s, channelID, edit[len(messageIDs):])
+	}
+	return messageIDs
+}
+
+// hasAttachments returns whether any of the public responses has attachments.
+func hasAttachments(responses dicebot.Responses) bool {
+	for _, response := range responses {
+		if response.Visibility != dicebot.Private && len(response.Attachments) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteMessages deletes messages the bot sent to a channel.
+func deleteMessages(s *discordgo.Session, channelID string, messageIDs []string) {
+	for _, messageID := range messageIDs {
+		if err := s.ChannelMessageDelete(channelID, messageID); err != nil {
+			logMessage(s, discordgo.LogError, "Unable to delete message %s: %s", messageID, err)
+		}
+	}
+}
+
+// sendResponse sends a response to a channel, using several messages if it is too long.
+func sendResponse(s *discordgo.Session, channelID string, response dicebot.Response) error {
+	for _, page := range pages(response) {
+		if _, err := s.ChannelMessageSendComplex(channelID, messageSend(channelID, page)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recipients returns the IDs of the users a private response should be sent to, including
+// the members of the recipient roles.
+func recipients(s *discordgo.Session, guildID string, response dicebot.Response) []string {
+	userIDs := append([]string(nil), response.Recipients...)
+	if len(response.RecipientRoles) == 0 {
+		return userIDs
+	}
+
+	guild, err := s.State.Guild(guildID)
+	if err != nil {
+		logMessage(s, discordgo.LogError, "Unable to retrieve guild info for %s: %s", guildID, err)
+		return userIDs
+	}
+	for _, member := range guild.Members {
+		for _, name := range roleNames(s, guildID, member.Roles) {
+			if containsFold(response.RecipientRoles, name) {
+				userIDs = append(userIDs, member.User.ID)
+				break
+			}
+		}
+	}
+	return userIDs
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendPrivate sends a private response as a direct message to all its recipients, except the
+// user with ID skip.
+func sendPrivate(s *discordgo.Session, guildID string, response dicebot.Response, skip string) {
+	sent := map[string]bool{skip: true}
+	for _, userID := range recipients(s, guildID, response) {
+		if sent[userID] {
+			continue
+		}
+		sent[userID] = true
+
+		channel, err := s.UserChannelCreate(userID)
+		if err == nil {
+			// Replies only work in the channel of the original message.
+			response.ReplyTo = ""
+			err = sendResponse(s, channel.ID, response)
 		}
 		if err != nil {
-			logMessage(s, discordgo.LogError, "Unable to send message to %s: %s", m.ChannelID, err)
+			logMessage(s, discordgo.LogError, "Unable to send direct message to %s: %s", userID, err)
 		}
 	}
 }
 
+// roleNames resolves role IDs to their names. Roles that are not known are returned as ID.
+func roleNames(s *discordgo.Session, guildID string, roleIDs []string) []string {
+	names := make([]string, len(roleIDs))
+	for i, id := range roleIDs {
+		if role, err := s.State.Role(guildID, id); err == nil {
+			names[i] = role.Name
+		} else {
+			names[i] = id
+		}
+	}
+	return names
+}
+
 func onGuildCreate(s *discordgo.Session, event *discordgo.GuildCreate) {
 	logMessage(s, discordgo.LogDebug, "Received guild event: %+v", event.Guild)
 }
 
-var commands = []discordgo.ApplicationCommand{
-	{
-		Name:        "roll",
-		Description: "Roll some dice",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "dice",
-				Description: "What dice to roll (2d6, d20+2)",
-				Required:    true,
-			},
-		},
-	},
-	{
-		Name:        "save",
-		Description: "Save a dice roll",
-		Options: []*discordgo.ApplicationCommandOption{
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "dice",
-				Description: "What dice to roll (2d6, d20+2)",
-				Required:    true,
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "name",
-				Description: "The name for this roll",
-				Required:    true,
-			},
-			{
-				Type:        discordgo.ApplicationCommandOptionString,
-				Name:        "for",
-				Description: "Who should be able to use this roll",
-				Required:    false,
-				Choices: []*discordgo.ApplicationCommandOptionChoice{
-					{Name: "just me", Value: "user"},
-					{Name: "this channel", Value: "channel"},
-					{Name: "whole server", Value: "server"},
-				},
-			},
-		},
-	},
+// applicationCommands builds the slash commands for all commands the bot knows.
+func applicationCommands() []*discordgo.ApplicationCommand {
+	var applicationCommands []*discordgo.ApplicationCommand
+	for _, command := range bot.Commands() {
+		applicationCommand := &discordgo.ApplicationCommand{
+			Name:        command.Name,
+			Description: command.Description,
+		}
+		for _, argument := range command.Arguments {
+			optionType := discordgo.ApplicationCommandOptionString
+			switch argument.Type {
+			case dicebot.BooleanArgument:
+				optionType = discordgo.ApplicationCommandOptionBoolean
+			case dicebot.UserArgument:
+				optionType = discordgo.ApplicationCommandOptionUser
+			}
+			option := &discordgo.ApplicationCommandOption{
+				Type:        optionType,
+				Name:        argument.Name,
+				Description: argument.Description,
+				Required:    argument.Required,
+				// Discord doesn't allow choices and autocomplete for the same option.
+				Autocomplete: argument.Autocomplete != nil && len(argument.Choices) == 0,
+			}
+			for _, choice := range argument.Choices {
+				option.Choices = append(option.Choices, &discordgo.ApplicationCommandOptionChoice{
+					Name:  choice.Name,
+					Value: choice.Value,
+				})
+			}
+			applicationCommand.Options = append(applicationCommand.Options, option)
+		}
+		applicationCommands = append(applicationCommands, applicationCommand)
+	}
+	return applicationCommands
 }
 
 func GetUser(i *discordgo.Interaction) *discordgo.User {
@@ -146,54 +380,169 @@ func onInteractionCreate(s *discordgo.Session, event *discordgo.InteractionCreat
 		UserName:  user.Username,
 		ChannelId: event.ChannelID,
 		ServerId:  channel.GuildID,
+		BotName:   s.State.User.Username,
+	}
+
+	if event.Member != nil {
+		context.Roles = roleNames(s, channel.GuildID, event.Member.Roles)
+		context.Permissions = event.Member.Permissions
+	}
+
+	var responses dicebot.Responses
+	switch event.Type {
+	case discordgo.InteractionApplicationCommandAutocomplete:
+		autocomplete(s, context, event.Interaction)
+		return
+	case discordgo.InteractionApplicationCommand:
+		responses = handleApplicationCommand(s, context, event.ApplicationCommandData())
+	case discordgo.InteractionMessageComponent:
+		responses = bot.HandleButton(context, event.MessageComponentData().CustomID)
+	default:
+		logMessage(s, discordgo.LogError, "Unknown interaction type %v", event.Type)
+	}
+	if len(responses) == 0 {
+		return
 	}
 
-	commandData := event.ApplicationCommandData()
+	respondInteraction(s, event.Interaction, channel.GuildID, responses)
+}
+
+func handleApplicationCommand(s *discordgo.Session, context dicebot.MessageContext, commandData discordgo.ApplicationCommandInteractionData) dicebot.Responses {
 	options := make(map[string]string, len(commandData.Options))
 	for _, option := range commandData.Options {
-		options[option.Name] = option.StringValue()
+		switch option.Type {
+		case discordgo.ApplicationCommandOptionBoolean:
+			if option.BoolValue() {
+				options[option.Name] = "true"
+			}
+		case discordgo.ApplicationCommandOptionUser:
+			// Users are passed like a mention in a message, so commands can show their name.
+			id := option.StringValue()
+			options[option.Name] = "<@" + id + ">"
+			if commandData.Resolved != nil && commandData.Resolved.Users[id] != nil {
+				mention := "@" + commandData.Resolved.Users[id].Username
+				if context.Mentions == nil {
+					context.Mentions = make(map[string]string)
+				}
+				context.Mentions[mention] = id
+				options[option.Name] = mention
+			}
+		default:
+			options[option.Name] = option.StringValue()
+		}
 	}
 
-	var response string
+	responses := bot.HandleCommand(context, commandData.Name, options)
+	if len(responses) == 0 {
+		logMessage(s, discordgo.LogError, "Unknown interaction command %v", commandData.Name)
+	}
+	return responses
+}
 
-	if commandData.Name == "roll" {
-		dice := options["dice"]
-		response = bot.RollDice(context, dice)
-	} else if commandData.Name == "save" {
-		dice, name, for_ := options["dice"], options["name"], options["for"]
-		if err := bot.Save(context, dice, name, for_); err != nil {
-			response = bot.HandleError(fmt.Sprintf("save %v as %v", dice, name), err)
-		} else {
-			response = fmt.Sprintf("Saved **%s** as `%s`", dice, name)
+// autocomplete responds to an interaction with the choices for the option that is being typed.
+func autocomplete(s *discordgo.Session, context dicebot.MessageContext, interaction *discordgo.Interaction) {
+	commandData := interaction.ApplicationCommandData()
+
+	var choices []*discordgo.ApplicationCommandOptionChoice
+	for _, option := range commandData.Options {
+		if !option.Focused {
+			continue
+		}
+		for _, choice := range bot.Autocomplete(context, commandData.Name, option.Name, option.StringValue()) {
+			choices = append(choices, &discordgo.ApplicationCommandOptionChoice{
+				Name:  choice.Name,
+				Value: choice.Value,
+			})
 		}
-	} else {
-		logMessage(s, discordgo.LogError, "Unknown interaction command %v", commandData.Name)
-		return
 	}
 
-	err = s.InteractionRespond(event.Interaction, &discordgo.InteractionResponse{
-		Type: discordgo.InteractionResponseChannelMessageWithSource,
-		Data: &discordgo.InteractionResponseData{
-			Content: response,
-		},
+	err := s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+		Type: discordgo.InteractionApplicationCommandAutocompleteResult,
+		Data: &discordgo.InteractionResponseData{Choices: choices},
 	})
 	if err != nil {
-		logMessage(s, discordgo.LogError, "Unable to send interaction response: %s", err)
+		logMessage(s, discordgo.LogError, "Unable to send autocomplete choices: %s", err)
+	}
+}
+
+// respondInteraction sends responses to an interaction.
+func respondInteraction(s *discordgo.Session, interaction *discordgo.Interaction, guildID string, responses dicebot.Responses) {
+	user := GetUser(interaction)
+
+	// The first response answers the interaction, the others are sent as follow-up messages.
+	// Private responses are only shown to the user that gave the command, and sent to other
+	// recipients as a direct message.
+	responded := false
+	for _, response := range responses {
+		var flags uint64
+		if response.Visibility == dicebot.Private {
+			if !containsString(response.Recipients, user.ID) {
+				sendPrivate(s, guildID, response, "")
+				continue
+			}
+			sendPrivate(s, guildID, response, user.ID)
+			flags = uint64(discordgo.MessageFlagsEphemeral)
+		}
+
+		for _, page := range pages(response) {
+			var err error
+			if !responded {
+				err = s.InteractionRespond(interaction, &discordgo.InteractionResponse{
+					Type: discordgo.InteractionResponseChannelMessageWithSource,
+					Data: interactionResponseData(page, flags),
+				})
+				responded = true
+			} else {
+				_, err = s.FollowupMessageCreate(interaction, false, webhookParams(page, flags))
+			}
+			if err != nil {
+				logMessage(s, discordgo.LogError, "Unable to send interaction response: %s", err)
+			}
+		}
 	}
 }
 
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func run(context *cli.Context) error {
 	token := context.String("token")
 	if token == "" {
 		return cli.Exit("Authentication token is required.", 1)
 	}
 
+	var db dicebot.Database
 	var err error
-	bot, err = dicebot.NewBot(context.String("database"))
+	if interval := context.Duration("snapshot-interval"); interval > 0 {
+		db, err = dicebot.NewMemoryDatabase(context.String("database"), interval)
+	} else {
+		db, err = dicebot.NewJsonDatabase(context.String("database"))
+	}
 	if err != nil {
 		return cli.Exit(fmt.Sprintf("Unable to open database: %s", err), 1)
 	}
 
+	permissions := dicebot.DefaultPermissions()
+	for _, role := range context.StringSlice("gm-role") {
+		permissions.AddRole(role, "channel", "server")
+	}
+
+	bot, err = dicebot.NewBot(dicebot.WithDatabase(db), dicebot.WithPermissions(permissions))
+	if err != nil {
+		return cli.Exit(fmt.Sprintf("Unable to create bot: %s", err), 1)
+	}
+	defer func() {
+		if err := bot.Close(); err != nil {
+			log.Printf("Unable to close database: %s", err)
+		}
+	}()
+
 	for _, filename := range context.StringSlice("moves") {
 		err = bot.LoadMoves(filename)
 		if err != nil {
@@ -201,6 +550,31 @@ func run(context *cli.Context) error {
 		}
 	}
 
+	for _, filename := range context.StringSlice("tables") {
+		err = bot.LoadTables(filename)
+		if err != nil {
+			return cli.Exit(fmt.Sprintf("Unable to load tables from %s: %s", filename, err), 1)
+		}
+	}
+
+	// Reload the moves and tables when receiving SIGHUP, so they can be changed without a restart.
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := bot.ReloadMoves(context.StringSlice("moves")...); err != nil {
+				log.Printf("Unable to reload moves: %s", err)
+			} else {
+				log.Printf("Reloaded moves")
+			}
+			if err := bot.ReloadTables(context.StringSlice("tables")...); err != nil {
+				log.Printf("Unable to reload tables: %s", err)
+			} else {
+				log.Printf("Reloaded tables")
+			}
+		}
+	}()
+
 	discord, err := discordgo.New("Bot " + token)
 	if err != nil {
 		return cli.Exit(fmt.Sprintf("Unable to create Discord session: %s", err), 1)
@@ -236,14 +610,14 @@ func run(context *cli.Context) error {
 		return cli.Exit(fmt.Sprintf("Unable to connect to Discord: %s", err), 1)
 	}
 
-	for _, command := range commands {
-		if _, err := discord.ApplicationCommandCreate(discord.State.User.ID, "", &command); err != nil {
+	for _, command := range applicationCommands() {
+		if _, err := discord.ApplicationCommandCreate(discord.State.User.ID, "", command); err != nil {
 			return cli.Exit(fmt.Sprintf("Unable to create command %v", command.Name), 1)
 		}
 	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, os.Kill)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
 
 	if err = discord.Close(); err != nil {
@@ -282,9 +656,21 @@ func main() {
 			Usage: "Database filename",
 			Value: "dicebot.json",
 		},
+		&cli.DurationFlag{
+			Name:  "snapshot-interval",
+			Usage: "Keep the database in memory, and only write it to disk at this interval",
+		},
 		&cli.StringSliceFlag{
 			Name:  "moves",
-			Usage: "Load moves from file",
+			Usage: "Load moves from a JSON, YAML or TOML file (reloaded on SIGHUP)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "tables",
+			Usage: "Load random tables from a JSON, YAML or TOML file (reloaded on SIGHUP)",
+		},
+		&cli.StringSliceFlag{
+			Name:  "gm-role",
+			Usage: "Allow users with this role to change channel and server variables",
 		},
 	}
 
@@ -0,0 +1,48 @@
+package main
+
+import "sync"
+
+// maxTrackedMessages is the number of messages whose replies are remembered, so the replies
+// can be edited when a message is edited. Only messages the bot replied to are tracked.
+const maxTrackedMessages = 1000
+
+type trackedMessage struct {
+	// Content is the content of the message the last time it was handled.
+	Content string
+	// Reply is the content of the first reply to the message.
+	Reply    string
+	ReplyIDs []string
+	// Attachments is whether the replies have attachments, which editing can't remove.
+	Attachments bool
+}
+
+// replyTracker remembers the replies to the most recent messages.
+type replyTracker struct {
+	mutex    sync.Mutex
+	messages map[string]trackedMessage
+	order    []string
+}
+
+var replies = &replyTracker{messages: make(map[string]trackedMessage)}
+
+func (tracker *replyTracker) get(messageID string) (trackedMessage, bool) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	message, found := tracker.messages[messageID]
+	return message, found
+}
+
+func (tracker *replyTracker) set(messageID string, message trackedMessage) {
+	tracker.mutex.Lock()
+	defer tracker.mutex.Unlock()
+
+	if _, found := tracker.messages[messageID]; !found {
+		tracker.order = append(tracker.order, messageID)
+		if len(tracker.order) > maxTrackedMessages {
+			delete(tracker.messages, tracker.order[0])
+			tracker.order = tracker.order[1:]
+		}
+	}
+	tracker.messages[messageID] = message
+}
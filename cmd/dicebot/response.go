@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/bwmarrin/discordgo"
+	"github.com/hackedd/dicebot"
+)
+
+func messageComponents(response dicebot.Response) []discordgo.MessageComponent {
+	if len(response.Buttons) == 0 {
+		return nil
+	}
+
+	var buttons []discordgo.MessageComponent
+	for _, button := range response.Buttons {
+		buttons = append(buttons, discordgo.Button{
+			Label:    button.Label,
+			Style:    discordgo.SecondaryButton,
+			CustomID: button.Action,
+		})
+	}
+	return []discordgo.MessageComponent{discordgo.ActionsRow{Components: buttons}}
+}
+
+// pages splits a response with long content into several responses that each fit in a
+// message. The first page is the reply, and the last page has the embed and attachments.
+func pages(response dicebot.Response) []dicebot.Response {
+	contents := dicebot.SplitContent(response.Content, dicebot.MaxResponseLength)
+	if len(contents) == 1 {
+		return []dicebot.Response{response}
+	}
+
+	responses := make([]dicebot.Response, len(contents))
+	for i, content := range contents {
+		page := response
+		page.Content = content
+		if i > 0 {
+			page.ReplyTo = ""
+		}
+		if i < len(contents)-1 {
+			page.Embed = nil
+			page.Attachments = nil
+			page.Buttons = nil
+		}
+		responses[i] = page
+	}
+	return responses
+}
+
+func messageEmbeds(response dicebot.Response) []*discordgo.MessageEmbed {
+	if response.Embed == nil {
+		return nil
+	}
+
+	embed := &discordgo.MessageEmbed{
+		Title:       response.Embed.Title,
+		Description: response.Embed.Description,
+	}
+	for _, field := range response.Embed.Fields {
+		embed.Fields = append(embed.Fields, &discordgo.MessageEmbedField{
+			Name:   field.Name,
+			Value:  field.Value,
+			Inline: field.Inline,
+		})
+	}
+	return []*discordgo.MessageEmbed{embed}
+}
+
+func messageFiles(response dicebot.Response) []*discordgo.File {
+	var files []*discordgo.File
+	for _, attachment := range response.Attachments {
+		files = append(files, &discordgo.File{
+			Name:        attachment.Name,
+			ContentType: "text/plain",
+			Reader:      strings.NewReader(attachment.Content),
+		})
+	}
+	return files
+}
+
+// messageSend converts a response to a message sent to a channel.
+func messageSend(channelID string, response dicebot.Response) *discordgo.MessageSend {
+	message := &discordgo.MessageSend{
+		Content:    response.Content,
+		Embeds:     messageEmbeds(response),
+		Files:      messageFiles(response),
+		Components: messageComponents(response),
+	}
+	if response.ReplyTo != "" {
+		message.Reference = &discordgo.MessageReference{MessageID: response.ReplyTo, ChannelID: channelID}
+	}
+	return message
+}
+
+// messageEdit converts a response to an edit of an earlier message. Attachments can't be
+// changed by an edit, so replies with attachments are sent again instead, see onMessageUpdate.
+func messageEdit(channelID, messageID string, response dicebot.Response) *discordgo.MessageEdit {
+	edit := discordgo.NewMessageEdit(channelID, messageID).SetContent(response.Content)
+	edit.Embeds = messageEmbeds(response)
+	edit.Components = messageComponents(response)
+	if edit.Components == nil {
+		edit.Components = []discordgo.MessageComponent{}
+	}
+	if edit.Embeds == nil {
+		edit.Embeds = []*discordgo.MessageEmbed{}
+	}
+	return edit
+}
+
+// interactionResponseData converts a response to the response to an interaction.
+func interactionResponseData(response dicebot.Response, flags uint64) *discordgo.InteractionResponseData {
+	return &discordgo.InteractionResponseData{
+		Content:    response.Content,
+		Embeds:     messageEmbeds(response),
+		Files:      messageFiles(response),
+		Components: messageComponents(response),
+		Flags:      flags,
+	}
+}
+
+// webhookParams converts a response to a follow-up message for an interaction.
+func webhookParams(response dicebot.Response, flags uint64) *discordgo.WebhookParams {
+	return &discordgo.WebhookParams{
+		Content:    response.Content,
+		Embeds:     messageEmbeds(response),
+		Files:      messageFiles(response),
+		Components: messageComponents(response),
+		Flags:      flags,
+	}
+}
@@ -0,0 +1,527 @@
+package dicebot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type Choice struct {
+	Name  string
+	Value string
+}
+
+type ArgumentType int
+
+const (
+	StringArgument ArgumentType = iota
+	// BooleanArgument is "true" when set, and empty otherwise.
+	BooleanArgument
+	// UserArgument is a user, written as a mention.
+	UserArgument
+)
+
+type Argument struct {
+	Name        string
+	Description string
+	Type        ArgumentType
+	Required    bool
+	Choices     []Choice
+	// Autocomplete suggests values while the argument of a slash command is typed.
+	Autocomplete Completer
+}
+
+type Handler func(bot *Bot, context MessageContext, args map[string]string) Responses
+
+// Completer returns the choices for an argument that start with or contain value.
+type Completer func(bot *Bot, context MessageContext, value string) []Choice
+
+// MaxChoices is the number of choices Autocomplete returns at most.
+const MaxChoices = 25
+
+// Command describes a command that can be given as a text message (like `!roll d6`) or as a
+// slash command.
+type Command struct {
+	Name    string
+	Aliases []string
+	// Description is a short description, used for slash commands.
+	Description string
+	// Help is a list of lines added to the usage message.
+	Help      []string
+	Arguments []Argument
+	// Pattern parses the text after the command name into arguments, using named groups. If
+	// the pattern is nil, all text is passed as the first argument.
+	Pattern *regexp.Regexp
+	Handler Handler
+}
+
+var commands []*Command
+
+var scopeChoices = []Choice{
+	{"just me", "user"},
+	{"this channel", "channel"},
+	{"whole server", "server"},
+}
+
+func init() {
+	commands = []*Command{
+		{
+			Name:        "roll",
+			Aliases:     []string{"r"},
+			Description: "Roll some dice",
+			Help: []string{
+				"Type `!roll d<x>` to roll a *x*-sided die",
+				"Type `!roll <n>d<x>` to roll any number of *x*-sided dice (`!roll 3d6` rolls three regular six-sided dice)",
+				"You can use simple mathematical expressions too. For example, `d20 + 4` rolls a twenty-sided dice and adds four to the result.",
+				"The bot understands addition, subtraction, multiplication, division and brackets.",
+				"Separate expressions with `;` or newlines to roll several at once, like `!roll d20+5; 2d6+3`.",
+			},
+			Arguments: []Argument{
+				{Name: "dice", Description: "What dice to roll (2d6, d20+2)", Required: true},
+				{Name: "secret", Description: "Only show the result to you and the GM", Type: BooleanArgument},
+			},
+			Handler: rollHandler,
+		},
+		{
+			Name:        "secret",
+			Aliases:     []string{"groll"},
+			Description: "Roll some dice, and only show the result to you and the GM",
+			Help: []string{
+				"Type `!secret <expr>` (or `!groll <expr>`) to roll in secret. The result is sent to you and the GM.",
+			},
+			Arguments: []Argument{
+				{Name: "dice", Description: "What dice to roll (2d6, d20+2)", Required: true},
+			},
+			Handler: secretHandler,
+		},
+		{
+			Name:        "save",
+			Description: "Save a dice roll",
+			Help: []string{
+				"Type `!save <expr> as <name>` to save an expression. For example you could `!save 2d6+1 as str` and use `!roll str` later.",
+				"Add `until <duration>` (like `until 1h`) or `until session end` to save an expression temporarily.",
+			},
+			Arguments: []Argument{
+				{Name: "dice", Description: "What dice to roll (2d6, d20+2)", Required: true},
+				{Name: "name", Description: "The name for this roll", Required: true},
+				{Name: "for", Description: "Who should be able to use this roll", Choices: scopeChoices},
+				{Name: "until", Description: "Forget this roll after a while (1h, session end)"},
+			},
+			Pattern: regexp.MustCompile(`\A(?P<dice>.*)\s+as\s+(?P<name>\w+)(?:\s+for\s+(?P<for>\w+))?(?:\s+until\s+(?P<until>.+))?\z`),
+			Handler: saveHandler,
+		},
+		{
+			Name:        "history",
+			Description: "Show the last rolls in this channel, or previous values of a saved roll",
+			Help: []string{
+				"Type `!history` to see the last rolls in this channel, and `!history <n>` to see the last *n* rolls.",
+				"Type `!history <name>` to see previous values of a saved expression.",
+			},
+			Arguments: []Argument{
+				{Name: "count", Description: "How many rolls to show"},
+				{Name: "name", Description: "The name of the saved roll"},
+				{Name: "for", Description: "Where the roll was saved", Choices: scopeChoices},
+			},
+			Pattern: regexp.MustCompile(`\A(?:(?P<count>\d+)|(?P<name>\w+)(?:\s+for\s+(?P<for>\w+))?)?\z`),
+			Handler: historyHandler,
+		},
+		{
+			Name:        "last",
+			Description: "Show your last roll in this channel",
+			Help: []string{
+				"Type `!last` to see your last roll in this channel, and `!reroll` to roll it again. After rolling several expressions at once, `!reroll` only rolls the last one.",
+			},
+			Handler: lastHandler,
+		},
+		{
+			Name:        "reroll",
+			Description: "Roll your last roll in this channel again",
+			Handler:     rerollHandler,
+		},
+		{
+			Name:        "undo",
+			Description: "Restore the previous value of a saved roll",
+			Help: []string{
+				"Type `!undo <name>` to restore the previous value of a saved expression.",
+			},
+			Arguments: []Argument{
+				{Name: "name", Description: "The name of the saved roll", Required: true},
+				{Name: "for", Description: "Where the roll was saved", Choices: scopeChoices},
+			},
+			Pattern: regexp.MustCompile(`\A(?P<name>\w+)(?:\s+for\s+(?P<for>\w+))?\z`),
+			Handler: undoHandler,
+		},
+		{
+			Name:        "session",
+			Description: "End the session, and forget temporary rolls",
+			Help: []string{
+				"Type `!session end` to forget all expressions that were saved until the end of the session.",
+			},
+			Arguments: []Argument{
+				{Name: "action", Description: "What to do", Required: true, Choices: []Choice{{"end the session", "end"}}},
+			},
+			Pattern: regexp.MustCompile(`\A(?P<action>end)\z`),
+			Handler: sessionHandler,
+		},
+		{
+			Name:        "quota",
+			Description: "Show how many rolls you can save",
+			Help: []string{
+				"Type `!quota` to see how many expressions you can save.",
+			},
+			Handler: quotaHandler,
+		},
+		{
+			Name:        "move",
+			Description: "Make a move",
+			Help: []string{
+				"Type `!move` to get a list of moves, and `!move <name>` to make a move. Add a stat or modifier like `!move defy danger +dex` to add it to the roll.",
+				"Type `!move search <text>` to find moves, and `!move info <name>` to see what a move does without rolling.",
+			},
+			Arguments: []Argument{
+				{Name: "name", Description: "The name of the move", Autocomplete: moveChoices},
+				{Name: "modifier", Description: "A stat or modifier to add to the roll (dex, +1)"},
+			},
+			Handler: moveHandler,
+		},
+		{
+			Name:        "playbook",
+			Description: "Show or choose your playbook",
+			Help: []string{
+				"Type `!playbook` to see the available playbooks, and `!playbook <name>` to choose yours. `!move` lists the basic moves and the moves of your playbook.",
+			},
+			Arguments: []Argument{
+				{Name: "name", Description: "The playbook to use, or none"},
+			},
+			Handler: playbookHandler,
+		},
+		{
+			Name:        "moveset",
+			Description: "Show, choose or upload the move sets for this server",
+			Help: []string{
+				"Type `!moveset` to see the move sets, `!moveset use <set>,<set>` to choose which to use, and `!moveset upload` with a JSON, YAML or TOML file attached to add one.",
+			},
+			Arguments: []Argument{
+				{Name: "action", Description: "What to do", Choices: []Choice{{"use move sets", "use"}, {"upload a move set", "upload"}, {"remove a move set", "remove"}}},
+				{Name: "value", Description: "The move sets to use, or the move set to remove"},
+			},
+			Pattern: regexp.MustCompile(`\A(?:(?P<action>use|upload|remove)(?:\s+(?P<value>[\s\S]+))?)?\z`),
+			Handler: movesetHandler,
+		},
+		{
+			Name:        "table",
+			Description: "Roll on a random table",
+			Help: []string{
+				"Type `!table` to see the random tables, and `!table <name>` to roll on one. Type `!table upload` with a JSON, YAML or TOML file attached to add tables, and `!table remove <file>` to remove them.",
+			},
+			Arguments: []Argument{
+				{Name: "name", Description: "The name of the table", Autocomplete: tableChoices},
+				{Name: "action", Description: "What to do", Choices: []Choice{{"upload a table file", "upload"}, {"remove a table file", "remove"}}},
+				{Name: "value", Description: "The table file to remove"},
+			},
+			Pattern: regexp.MustCompile(`\A(?:(?P<action>upload|remove)(?:\s+(?P<value>[\s\S]+))?|(?P<name>[\s\S]+))?\z`),
+			Handler: tableHandler,
+		},
+		{
+			Name:        "hold",
+			Description: "Show or spend your hold, forward and ongoing bonuses",
+			Help: []string{
+				"Type `!hold` to see the hold and bonuses moves gave you, and `!hold spend [n] [move]` to spend hold.",
+				"Type `!forward +1` or `!ongoing +1` to add a bonus, and `!forward clear` to remove it. Forward is added to your next move or roll. Only the GM can add bonuses and hold, anyone can take a penalty like `!forward -1`.",
+				"The GM gives a player hold or a bonus by mentioning them, like `!hold add 3 Defend @Player` or `!forward +1 @Player`.",
+			},
+			Arguments: []Argument{
+				{Name: "action", Description: "What to do with hold", Choices: []Choice{{"spend hold", "spend"}, {"add hold", "add"}}},
+				{Name: "count", Description: "How much hold to spend or add"},
+				{Name: "move", Description: "The move the hold is for"},
+				{Name: "user", Description: "The player whose hold it is", Type: UserArgument},
+			},
+			Pattern: regexp.MustCompile(`\A(?:(?P<action>spend|add)(?:\s+(?P<count>\d+))?(?:\s+(?P<move>[^\s@<].*?))?)?(?:\s*(?P<user><@!?\d+>|@.+))?\z`),
+			Handler: holdHandler,
+		},
+		{
+			Name:        "forward",
+			Description: "Show or change your forward bonus",
+			Arguments: []Argument{
+				{Name: "bonus", Description: "The bonus to add (+1), or clear"},
+				{Name: "user", Description: "The player whose bonus it is", Type: UserArgument},
+			},
+			Pattern: regexp.MustCompile(`\A(?P<bonus>[+-]?\d+|clear)?(?:\s*(?P<user><@!?\d+>|@.+))?\z`),
+			Handler: bonusHandler("forward"),
+		},
+		{
+			Name:        "ongoing",
+			Description: "Show or change your ongoing bonus",
+			Arguments: []Argument{
+				{Name: "bonus", Description: "The bonus to add (+1), or clear"},
+				{Name: "user", Description: "The player whose bonus it is", Type: UserArgument},
+			},
+			Pattern: regexp.MustCompile(`\A(?P<bonus>[+-]?\d+|clear)?(?:\s*(?P<user><@!?\d+>|@.+))?\z`),
+			Handler: bonusHandler("ongoing"),
+		},
+		{
+			Name:        "xp",
+			Description: "Show or change your XP",
+			Help: []string{
+				"Type `!xp` to see your XP, `!xp +1` to mark XP, `!xp -8` to spend XP, and `!xp table` to see everybody's XP. Moves award XP automatically. The GM can award XP to a player by mentioning them, like `!xp +2 @Player`.",
+			},
+			Arguments: []Argument{
+				{Name: "amount", Description: "The XP to add (+1), or table"},
+				{Name: "user", Description: "The player to award XP to", Type: UserArgument},
+			},
+			Pattern: regexp.MustCompile(`\A(?P<amount>[+-]?\d+|table)?(?:\s*(?P<user><@!?\d+>|@.+))?\z`),
+			Handler: xpHandler,
+		},
+		{
+			Name:        "config",
+			Description: "Change the settings for this server",
+			Help: []string{
+				"Type `!config` to see the settings for this server, and `!config <setting> <value>` to change them.",
+				"Type `!config alias <name> <command>` to add an alias. For example, `!config alias atk roll d20+str` lets you type `!atk`.",
+			},
+			Arguments: []Argument{
+				{Name: "setting", Description: "The setting to change, or alias"},
+				{Name: "value", Description: "The new value"},
+			},
+			Pattern: regexp.MustCompile(`\A(?:(?P<setting>\S+)(?:\s+(?P<value>.+))?)?\z`),
+			Handler: configHandler,
+		},
+		{
+			Name:        "help",
+			Description: "Show what the bot can do",
+			Handler:     helpHandler,
+		},
+	}
+}
+
+func (bot *Bot) Commands() []*Command {
+	return commands
+}
+
+// FindCommand returns the command with the given name or alias, or nil.
+func (bot *Bot) FindCommand(name string) *Command {
+	name = strings.ToLower(name)
+	for _, command := range commands {
+		if command.Name == name {
+			return command
+		}
+		for _, alias := range command.Aliases {
+			if alias == name {
+				return command
+			}
+		}
+	}
+	return nil
+}
+
+// Autocomplete returns the choices for an argument of a command, while value is typed.
+func (bot *Bot) Autocomplete(context MessageContext, name, argument, value string) []Choice {
+	command := bot.FindCommand(name)
+	if command == nil {
+		return nil
+	}
+	for _, arg := range command.Arguments {
+		if arg.Name == argument && arg.Autocomplete != nil {
+			choices := arg.Autocomplete(bot, context, value)
+			if len(choices) > MaxChoices {
+				choices = choices[:MaxChoices]
+			}
+			return choices
+		}
+	}
+	return nil
+}
+
+func (bot *Bot) Usage() string {
+	var lines []string
+	for _, command := range commands {
+		lines = append(lines, command.Help...)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (command *Command) requiresArguments() bool {
+	for _, argument := range command.Arguments {
+		if argument.Required {
+			return true
+		}
+	}
+	return false
+}
+
+// parse parses the text after the command name into arguments.
+func (command *Command) parse(text string) (map[string]string, bool) {
+	args := make(map[string]string)
+
+	if command.Pattern == nil {
+		if len(command.Arguments) > 0 {
+			args[command.Arguments[0].Name] = text
+		} else if text != "" {
+			return nil, false
+		}
+		return args, true
+	}
+
+	match := command.Pattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, false
+	}
+	for i, name := range command.Pattern.SubexpNames() {
+		if name != "" {
+			args[name] = match[i]
+		}
+	}
+	return args, true
+}
+
+// HandleCommand runs a command with arguments that have already been parsed, like those of a
+// slash command. It returns no responses if the command is unknown.
+func (bot *Bot) HandleCommand(context MessageContext, name string, args map[string]string) Responses {
+	command := bot.FindCommand(name)
+	if command == nil {
+		return nil
+	}
+
+	for _, argument := range command.Arguments {
+		if argument.Required && args[argument.Name] == "" {
+			return reply(bot.Usage())
+		}
+	}
+
+	return command.Handler(bot, context, args)
+}
+
+// splitCommand splits the text of a command into the command name and its arguments.
+func splitCommand(msg string) (name, text string) {
+	name = msg
+	if i := strings.IndexFunc(name, isSpace); i >= 0 {
+		name, text = name[:i], strings.TrimSpace(name[i:])
+	}
+	return
+}
+
+// findMessageCommand finds the command a message starts with, expanding aliases. It returns
+// the command, the text of the command without prefix and the arguments. If the message
+// does not contain a command, the command is nil and the message is returned unchanged.
+func (bot *Bot) findMessageCommand(context MessageContext, msg string) (*Command, string, string) {
+	prefix := bot.prefix(context)
+	if !strings.HasPrefix(msg, prefix) {
+		return nil, msg, ""
+	}
+	commandText := strings.TrimSpace(msg[len(prefix):])
+
+	name, text := splitCommand(commandText)
+	if command := bot.FindCommand(name); command != nil {
+		return command, commandText, text
+	}
+
+	alias, ok := bot.Alias(context, name)
+	if !ok {
+		return nil, msg, ""
+	}
+	commandText = strings.TrimSpace(alias + " " + text)
+	name, text = splitCommand(commandText)
+	if command := bot.FindCommand(name); command != nil {
+		return command, commandText, text
+	}
+	return nil, msg, ""
+}
+
+func (bot *Bot) HandleMessage(context MessageContext, msg string) Responses {
+	msg = strings.TrimSpace(msg)
+
+	command, msg, text := bot.findMessageCommand(context, msg)
+	if command == nil {
+		if bot.Setting(context, "inline") == "on" {
+			return reply(bot.InlineRolls(context, msg))
+		}
+		return nil
+	}
+
+	if text == "help" || (text == "" && command.requiresArguments()) {
+		return reply(bot.Usage())
+	}
+
+	args, ok := command.parse(text)
+	if !ok {
+		return reply(bot.HandleError(msg, nil))
+	}
+
+	return command.Handler(bot, context, args)
+}
+
+func isSpace(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\n' || r == '\r'
+}
+
+// withScope adds the "for" argument of a command back to its text, for use in error messages.
+func withScope(text, for_ string) string {
+	if for_ != "" {
+		text += " for " + for_
+	}
+	return text
+}
+
+func rollHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	if args["secret"] == "true" {
+		return bot.SecretRoll(context, args["dice"])
+	}
+	return Responses{bot.RollDice(context, args["dice"])}
+}
+
+func saveHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	dice, name, for_, until := args["dice"], args["name"], args["for"], args["until"]
+
+	err := bot.SaveUntil(context, dice, name, for_, until)
+	if err != nil {
+		text := withScope(fmt.Sprintf("save %s as %s", dice, name), for_)
+		if until != "" {
+			text += " until " + until
+		}
+		return reply(bot.HandleError(text, err))
+	}
+	if until != "" {
+		return reply(fmt.Sprintf("Saved **%s** as `%s` until %s", dice, name, until))
+	}
+	return reply(fmt.Sprintf("Saved **%s** as `%s`", dice, name))
+}
+
+func undoHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	response, err := bot.Undo(context, args["name"], args["for"])
+	if err != nil {
+		return reply(bot.HandleError(withScope("undo "+args["name"], args["for"]), err))
+	}
+	return reply(response)
+}
+
+func sessionHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	return reply(bot.EndSession(context))
+}
+
+func quotaHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	return reply(bot.Quota(context))
+}
+
+func moveHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	text := strings.TrimSpace(args["name"] + " " + args["modifier"])
+	if text == "" {
+		return reply(bot.ListMoves(context))
+	}
+
+	// Moves named like an action can still be made, by their full name.
+	if action, value := splitCommand(text); value != "" {
+		if _, modifier, found := bot.findMove(context, text); !found || modifier != "" {
+			switch strings.ToLower(action) {
+			case "search":
+				return reply(bot.SearchMoves(context, value))
+			case "info":
+				return Responses{bot.MoveInfo(context, value)}
+			}
+		}
+	}
+	return Responses{bot.MakeMove(context, text)}
+}
+
+func helpHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	return reply(bot.Usage())
+}
@@ -0,0 +1,84 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestBot_FindCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"roll", "roll"},
+		{"ROLL", "roll"},
+		{"r", "roll"},
+		{"save", "save"},
+		{"rolld6", ""},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		command := bot.FindCommand(test.name)
+		if command == nil && test.expected != "" || command != nil && command.Name != test.expected {
+			t.Errorf("FindCommand(%v) got %+v expected %v", test.name, command, test.expected)
+		}
+	}
+}
+
+func TestCommands(t *testing.T) {
+	names := make(map[string]bool)
+	for _, command := range bot.Commands() {
+		if command.Description == "" || command.Handler == nil {
+			t.Errorf("Command %v needs a description and a handler", command.Name)
+		}
+		if names[command.Name] {
+			t.Errorf("Command %v is defined twice", command.Name)
+		}
+		names[command.Name] = true
+
+		if command.Pattern == nil {
+			continue
+		}
+		for _, argument := range command.Arguments {
+			if command.Pattern.SubexpIndex(argument.Name) < 0 {
+				t.Errorf("Pattern of command %v does not match argument %v", command.Name, argument.Name)
+			}
+		}
+	}
+}
+
+func TestBot_Usage(t *testing.T) {
+	usage := bot.Usage()
+	for _, command := range []string{"!roll", "!save", "!history", "!undo", "!last", "!reroll", "!session", "!quota", "!move"} {
+		if !strings.Contains(usage, "`"+command) {
+			t.Errorf("Usage() should explain %v", command)
+		}
+	}
+}
+
+func ExampleBot_HandleMessage_alias() {
+	rand.Seed(1)
+	fmt.Println(handleMessage("!r d6"))
+	fmt.Println(handleMessage("!help")[:25] + "...")
+	// Output:
+	// d6 => **6**
+	// Type `!roll d<x>` to roll...
+}
+
+func ExampleBot_HandleCommand() {
+	rand.Seed(1)
+	fmt.Println(bot.HandleCommand(context, "roll", map[string]string{"dice": "2d6"}))
+	fmt.Println(bot.HandleCommand(context, "save", map[string]string{"dice": "3", "name": "three", "for": "channel"}))
+	fmt.Println(bot.HandleCommand(context, "save", map[string]string{"dice": "3", "name": "three", "for": "party"}))
+	fmt.Println(bot.HandleCommand(context, "roll", map[string]string{}).String()[:25] + "...")
+	fmt.Printf("%q\n", bot.HandleCommand(context, "unknown", nil))
+	// Output:
+	// 2d6 => **(6 + 4)** => **10**
+	// Saved **3** as `three`
+	// Sorry, I don't understand how to parse 'save 3 as three for party': undefined scope party
+	// Type `!roll d<x>` to roll...
+	// ""
+}
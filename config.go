@@ -0,0 +1,236 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MentionPrefix is the prefix setting that makes the bot respond to messages that start with
+// a mention of the bot.
+const MentionPrefix = "mention"
+
+const aliasPrefix = "alias:"
+
+// Setting is a per-server setting that can be changed with `!config`.
+type Setting struct {
+	Name        string
+	Description string
+	Default     string
+	// Parse checks a new value, and returns the value to store.
+	Parse func(context MessageContext, value string) (string, error)
+}
+
+var settings = []*Setting{
+	{
+		Name:        "prefix",
+		Description: "the prefix for commands, or `mention` to respond to mentions of the bot",
+		Default:     "!",
+		Parse:       parsePrefix,
+	},
+	{
+		Name:        "inline",
+		Description: "`on` to roll dice written as `[[d20+5]]` in any message",
+		Default:     "on",
+		Parse:       parseOnOff,
+	},
+	{
+		Name:        "edits",
+		Description: "what to do when a command is edited: `reroll`, `show` the original result too, or `refuse`",
+		Default:     "show",
+		Parse:       parseEdits,
+	},
+	{
+		Name:        "moves",
+		Description: "the move sets to use, or `all`",
+		Default:     "all",
+		Parse:       parseMoveSets,
+	},
+	{
+		Name:        "xp-levels",
+		Description: "the XP needed for each level, like `8,17,27`",
+		Default:     "none",
+		Parse:       parseLevels,
+	},
+	{
+		Name:        "gm",
+		Description: "the ID of the user that sees secret rolls, or `me`",
+		Default:     "none",
+		Parse:       parseUser,
+	},
+	{
+		Name:        "gm-role",
+		Description: "the role whose members see secret rolls",
+		Default:     "none",
+	},
+}
+
+func parsePrefix(context MessageContext, value string) (string, error) {
+	if value == "" || len(value) > 10 || strings.IndexFunc(value, isSpace) >= 0 {
+		return "", errors.New("the prefix must be between 1 and 10 characters, without spaces")
+	}
+	return value, nil
+}
+
+// parseUser parses a user ID, which may be written as a mention. `me` is the user changing
+// the setting.
+func parseUser(context MessageContext, value string) (string, error) {
+	switch value {
+	case "me":
+		return context.UserId, nil
+	case "none":
+		return value, nil
+	}
+	if id, ok := context.Mentions[value]; ok {
+		return id, nil
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(value, "<@"), "!"), ">")
+	if id == "" || strings.IndexFunc(id, func(r rune) bool { return r < '0' || r > '9' }) >= 0 {
+		return "", errors.New("the value must be a mention, a user ID, `me` or `none`")
+	}
+	return id, nil
+}
+
+func findSetting(name string) *Setting {
+	for _, setting := range settings {
+		if setting.Name == name {
+			return setting
+		}
+	}
+	return nil
+}
+
+func (context MessageContext) configScope() string {
+	return "config-server-" + context.ServerId
+}
+
+// Setting returns the value of a setting for the server a message was sent on.
+func (bot *Bot) Setting(context MessageContext, name string) string {
+	if value, found := bot.db.ReadValue(name, context.configScope()); found {
+		return value
+	}
+	if setting := findSetting(name); setting != nil {
+		return setting.Default
+	}
+	return ""
+}
+
+// SetSetting changes a setting for the server a message was sent on.
+func (bot *Bot) SetSetting(context MessageContext, name, value string) error {
+	if err := bot.checkRule(context, "config", "change the configuration"); err != nil {
+		return err
+	}
+
+	setting := findSetting(name)
+	if setting == nil {
+		return errors.New(fmt.Sprintf("unknown setting `%s`", name))
+	}
+	if value == "" {
+		value = setting.Default
+	}
+	if setting.Parse != nil {
+		var err error
+		if value, err = setting.Parse(context, value); err != nil {
+			return err
+		}
+	}
+
+	return bot.storeConfig(context, name, value)
+}
+
+func (bot *Bot) storeConfig(context MessageContext, name, value string) error {
+	revision := Revision{Value: value, Author: context.UserName, Time: time.Now()}
+	return bot.db.StoreRevision(name, context.configScope(), revision)
+}
+
+// prefix returns the prefix for commands on the server a message was sent on.
+func (bot *Bot) prefix(context MessageContext) string {
+	prefix := bot.Setting(context, "prefix")
+	if prefix == MentionPrefix {
+		return "@" + context.BotName
+	}
+	return prefix
+}
+
+// Alias returns the command text an alias expands to.
+func (bot *Bot) Alias(context MessageContext, name string) (string, bool) {
+	return bot.db.ReadValue(aliasPrefix+strings.ToLower(name), context.configScope())
+}
+
+// SetAlias makes name an alias for the command text. An empty text removes the alias.
+func (bot *Bot) SetAlias(context MessageContext, name, text string) error {
+	if err := bot.checkRule(context, "config", "change the configuration"); err != nil {
+		return err
+	}
+
+	name = strings.ToLower(name)
+	if text == "" {
+		return bot.db.DeleteValue(aliasPrefix+name, context.configScope())
+	}
+
+	if bot.FindCommand(name) != nil {
+		return errors.New(fmt.Sprintf("`%s` is already a command", name))
+	}
+	command := strings.Fields(text)[0]
+	if bot.FindCommand(command) == nil {
+		return errors.New(fmt.Sprintf("unknown command `%s`", command))
+	}
+
+	return bot.storeConfig(context, aliasPrefix+name, text)
+}
+
+func (bot *Bot) ShowConfig(context MessageContext) string {
+	s := "Settings for this server:\n"
+	for _, setting := range settings {
+		s += fmt.Sprintf(" * %s: `%s` (%s)\n", setting.Name, bot.Setting(context, setting.Name), setting.Description)
+	}
+
+	var aliases []string
+	for _, name := range bot.db.ListValues(context.configScope()) {
+		if strings.HasPrefix(name, aliasPrefix) {
+			aliases = append(aliases, name[len(aliasPrefix):])
+		}
+	}
+	sort.Strings(aliases)
+
+	if len(aliases) > 0 {
+		s += "Aliases:\n"
+		for _, alias := range aliases {
+			text, _ := bot.Alias(context, alias)
+			s += fmt.Sprintf(" * `%s`: `%s`\n", alias, text)
+		}
+	}
+	return s
+}
+
+func configHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	name, value := strings.ToLower(args["setting"]), strings.TrimSpace(args["value"])
+	if name == "" {
+		return reply(bot.ShowConfig(context))
+	}
+
+	if name == "alias" {
+		alias, text := value, ""
+		if i := strings.IndexFunc(value, isSpace); i >= 0 {
+			alias, text = value[:i], strings.TrimSpace(value[i:])
+		}
+		if alias == "" {
+			return reply(bot.HandleError("config alias", nil))
+		}
+		if err := bot.SetAlias(context, alias, text); err != nil {
+			return reply(bot.HandleError(strings.TrimSpace("config alias "+value), err))
+		}
+		if text == "" {
+			return reply(fmt.Sprintf("Removed alias `%s`", alias))
+		}
+		return reply(fmt.Sprintf("`%s` is now an alias for `%s`", alias, text))
+	}
+
+	if err := bot.SetSetting(context, name, value); err != nil {
+		return reply(bot.HandleError(strings.TrimSpace("config "+name+" "+value), err))
+	}
+	return reply(fmt.Sprintf("Changed %s to `%s`", name, bot.Setting(context, name)))
+}
@@ -0,0 +1,120 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/bwmarrin/discordgo"
+)
+
+func ExampleBot_HandleMessage_config() {
+	bot := &Bot{db: &JsonDatabase{}, permissions: DefaultPermissions()}
+	admin := context
+	admin.Permissions = PermissionManageGuild
+
+	fmt.Print(bot.HandleMessage(context, "!config"))
+	fmt.Println(bot.HandleMessage(context, "!config prefix ."))
+	fmt.Println(bot.HandleMessage(admin, "!config prefix ."))
+	fmt.Printf("%q\n", bot.HandleMessage(context, "!roll 1"))
+	fmt.Println(bot.HandleMessage(context, ".roll 1"))
+	fmt.Println(bot.HandleMessage(admin, ".config prefix two words"))
+	fmt.Println(bot.HandleMessage(admin, ".config colour blue"))
+	fmt.Println(bot.HandleMessage(admin, ".config prefix"))
+	fmt.Println(bot.HandleMessage(context, "!roll 1"))
+	// Output:
+	// Settings for this server:
+	//  * prefix: `!` (the prefix for commands, or `mention` to respond to mentions of the bot)
+	//  * inline: `on` (`on` to roll dice written as `[[d20+5]]` in any message)
+	//  * edits: `show` (what to do when a command is edited: `reroll`, `show` the original result too, or `refuse`)
+	//  * moves: `all` (the move sets to use, or `all`)
+	//  * xp-levels: `none` (the XP needed for each level, like `8,17,27`)
+	//  * gm: `none` (the ID of the user that sees secret rolls, or `me`)
+	//  * gm-role: `none` (the role whose members see secret rolls)
+	// Sorry, you don't have permission to change the configuration
+	// Changed prefix to `.`
+	// ""
+	// 1 => **1**
+	// Sorry, I don't understand how to parse 'config prefix two words': the prefix must be between 1 and 10 characters, without spaces
+	// Sorry, I don't understand how to parse 'config colour blue': unknown setting `colour`
+	// Changed prefix to `!`
+	// 1 => **1**
+}
+
+func ExampleBot_HandleMessage_configMention() {
+	bot := &Bot{db: &JsonDatabase{}}
+	context := context
+	context.BotName = "dicebot"
+
+	fmt.Println(bot.HandleMessage(context, "!config prefix mention"))
+	fmt.Println(bot.HandleMessage(context, "@dicebot roll 2"))
+	// Output:
+	// Changed prefix to `mention`
+	// 2 => **2**
+}
+
+func ExampleBot_HandleMessage_configAlias() {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}}
+
+	fmt.Println(bot.HandleMessage(context, "!config alias atk roll d20+5"))
+	fmt.Println(bot.HandleMessage(context, "!config alias dmg roll 2d6+3"))
+	fmt.Println(bot.HandleMessage(context, "!atk"))
+	fmt.Println(bot.HandleMessage(context, "!atk +2"))
+	fmt.Println(bot.HandleMessage(context, "!config alias roll save"))
+	fmt.Println(bot.HandleMessage(context, "!config alias x frobnicate"))
+	fmt.Print(bot.HandleMessage(context, "!config"))
+	fmt.Println(bot.HandleMessage(context, "!config alias atk"))
+	fmt.Printf("%q\n", bot.HandleMessage(context, "!atk"))
+	// Output:
+	// `atk` is now an alias for `roll d20+5`
+	// `dmg` is now an alias for `roll 2d6+3`
+	// d20+5 => **2 + 5** => **7**
+	// d20+5 +2 => **8 + 5 + 2** => **15**
+	// Sorry, I don't understand how to parse 'config alias roll save': `roll` is already a command
+	// Sorry, I don't understand how to parse 'config alias x frobnicate': unknown command `frobnicate`
+	// Settings for this server:
+	//  * prefix: `!` (the prefix for commands, or `mention` to respond to mentions of the bot)
+	//  * inline: `on` (`on` to roll dice written as `[[d20+5]]` in any message)
+	//  * edits: `show` (what to do when a command is edited: `reroll`, `show` the original result too, or `refuse`)
+	//  * moves: `all` (the move sets to use, or `all`)
+	//  * xp-levels: `none` (the XP needed for each level, like `8,17,27`)
+	//  * gm: `none` (the ID of the user that sees secret rolls, or `me`)
+	//  * gm-role: `none` (the role whose members see secret rolls)
+	// Aliases:
+	//  * `atk`: `roll d20+5`
+	//  * `dmg`: `roll 2d6+3`
+	// Removed alias `atk`
+	// ""
+}
+
+func ExampleBot_HandleMessage_configGM() {
+	bot := &Bot{db: &JsonDatabase{}}
+
+	fmt.Println(bot.HandleMessage(context, "!config gm me"))
+	fmt.Println(bot.HandleMessage(context, "!config gm <@!42>"))
+	fmt.Println(bot.HandleMessage(context, "!config gm somebody"))
+	fmt.Println(bot.HandleMessage(context, "!config gm"))
+	// Output:
+	// Changed gm to `user`
+	// Changed gm to `42`
+	// Sorry, I don't understand how to parse 'config gm somebody': the value must be a mention, a user ID, `me` or `none`
+	// Changed gm to `none`
+}
+
+func TestBot_HandleMessage_configGMMention(t *testing.T) {
+	bot := &Bot{db: &JsonDatabase{}}
+
+	// This is what the Discord client does with a message that mentions a user.
+	message := &discordgo.Message{
+		Content:  "!config gm <@!42>",
+		Mentions: []*discordgo.User{{ID: "42", Username: "Game Master"}},
+	}
+	context := context
+	context.Mentions = map[string]string{"@Game Master": "42"}
+
+	bot.HandleMessage(context, message.ContentWithMentionsReplaced())
+	if gm := bot.Setting(context, "gm"); gm != "42" {
+		t.Errorf("Setting(gm): expected 42, got %q", gm)
+	}
+}
@@ -2,50 +2,288 @@ package dicebot
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
+// MaxHistory is the number of previous values kept for every variable.
+const MaxHistory = 10
+
+// MaxRolls is the number of rolls kept in the log of every scope.
+const MaxRolls = 100
+
+type Revision struct {
+	Value  string
+	Author string
+	Time   time.Time
+	// Expires is the time after which the value is ignored. The zero value never expires.
+	Expires time.Time
+	// Session marks a value that is removed when the session ends.
+	Session string
+}
+
+func (revision Revision) Expired(now time.Time) bool {
+	return !revision.Expires.IsZero() && !now.Before(revision.Expires)
+}
+
+// LoggedRoll is a roll that was evaluated by the bot.
+type LoggedRoll struct {
+	UserId      string
+	UserName    string
+	ChannelId   string
+	ServerId    string
+	Input       string
+	Explanation string
+	Result      int
+	Time        time.Time
+}
+
 type Database interface {
 	ReadValue(name, scope string) (string, bool)
 	StoreValue(name, scope, value string) error
+	StoreRevision(name, scope string, revision Revision) error
+	ReadHistory(name, scope string) []Revision
+	UndoValue(name, scope string) (Revision, bool, error)
+	DeleteValue(name, scope string) error
+	ListValues(scope string) []string
+	ListScopes(prefix string) []string
+	PurgeExpired() error
+	EndSession(session string) (int, error)
+	LogRoll(scope string, roll LoggedRoll) error
+	ReadRolls(scope string) []LoggedRoll
+	Close() error
+}
+
+type JsonRevision struct {
+	Value   string `json:"value"`
+	Author  string `json:"author,omitempty"`
+	Time    int64  `json:"time,omitempty"`
+	Expires int64  `json:"expires,omitempty"`
+	Session string `json:"session,omitempty"`
 }
 
 type JsonVariable struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	Name    string         `json:"name"`
+	Value   string         `json:"value"`
+	Author  string         `json:"author,omitempty"`
+	Time    int64          `json:"time,omitempty"`
+	Expires int64          `json:"expires,omitempty"`
+	Session string         `json:"session,omitempty"`
+	History []JsonRevision `json:"history,omitempty"`
+}
+
+type JsonRoll struct {
+	UserId      string `json:"user_id"`
+	UserName    string `json:"user_name"`
+	ChannelId   string `json:"channel_id"`
+	ServerId    string `json:"server_id"`
+	Input       string `json:"input"`
+	Explanation string `json:"explanation"`
+	Result      int    `json:"result"`
+	Time        int64  `json:"time"`
 }
 
 type JsonScope struct {
 	Name      string         `json:"name"`
 	Variables []JsonVariable `json:"variables"`
+	Rolls     []JsonRoll     `json:"rolls,omitempty"`
 }
 
+// MemoryDatabase keeps all values in memory. It can optionally restore its contents from a
+// snapshot file on start, and write snapshots to that file periodically and when closed.
+type MemoryDatabase struct {
+	mutex  sync.RWMutex
+	scopes []JsonScope
+
+	snapshotFile string
+	stop         chan struct{}
+	stopped      chan struct{}
+}
+
+// RollsPerSave is the number of rolls JsonDatabase logs before it writes its file. Changes to
+// variables are written immediately, and take unsaved rolls with them.
+const RollsPerSave = 20
+
+// JsonDatabase is a MemoryDatabase that writes its contents to a file after every change to a
+// variable. Logged rolls are written in batches of RollsPerSave, and when it is closed.
 type JsonDatabase struct {
+	MemoryDatabase
 	filename string
-	scopes   []JsonScope
+	// unsavedRolls is the number of rolls logged since the file was written.
+	unsavedRolls int
+}
+
+// NewMemoryDatabase creates a database that is restored from snapshotFile, if it exists. If
+// interval is not zero, a snapshot is written to snapshotFile at that interval.
+func NewMemoryDatabase(snapshotFile string, interval time.Duration) (*MemoryDatabase, error) {
+	db := &MemoryDatabase{snapshotFile: snapshotFile}
+
+	if snapshotFile != "" {
+		if err := db.Restore(snapshotFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if snapshotFile != "" && interval > 0 {
+		db.stop = make(chan struct{})
+		db.stopped = make(chan struct{})
+		go db.snapshotLoop(interval)
+	}
+
+	return db, nil
 }
 
 func NewJsonDatabase(filename string) (Database, error) {
 	db := &JsonDatabase{filename: filename}
 
+	if err := db.Restore(filename); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func toUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(t int64) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t, 0)
+}
+
+func toJsonRevision(revision Revision) JsonRevision {
+	return JsonRevision{
+		Value:   revision.Value,
+		Author:  revision.Author,
+		Time:    toUnix(revision.Time),
+		Expires: toUnix(revision.Expires),
+		Session: revision.Session,
+	}
+}
+
+func fromJsonRevision(r JsonRevision) Revision {
+	return Revision{
+		Value:   r.Value,
+		Author:  r.Author,
+		Time:    fromUnix(r.Time),
+		Expires: fromUnix(r.Expires),
+		Session: r.Session,
+	}
+}
+
+func (v *JsonVariable) current() JsonRevision {
+	return JsonRevision{v.Value, v.Author, v.Time, v.Expires, v.Session}
+}
+
+func (v *JsonVariable) setCurrent(r JsonRevision) {
+	v.Value, v.Author, v.Time, v.Expires, v.Session = r.Value, r.Author, r.Time, r.Expires, r.Session
+}
+
+func (v *JsonVariable) expired(now time.Time) bool {
+	return v.Expires != 0 && now.Unix() >= v.Expires
+}
+
+// Restore replaces the contents of the database with the contents of a snapshot file. A
+// snapshot file that does not exist is treated as empty.
+func (db *MemoryDatabase) Restore(filename string) error {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return db, nil
+			return nil
 		}
-		return nil, err
+		return err
+	}
+
+	var scopes []JsonScope
+	if err = json.Unmarshal(data, &scopes); err != nil {
+		return err
 	}
 
-	err = json.Unmarshal(data, &db.scopes)
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+	db.scopes = scopes
+	return nil
+}
+
+// Snapshot writes the contents of the database to a file.
+func (db *MemoryDatabase) Snapshot(filename string) error {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+	return db.writeFile(filename)
+}
+
+// writeFile writes the contents of the database to a file. The caller must hold the mutex.
+func (db *MemoryDatabase) writeFile(filename string) error {
+	data, err := json.MarshalIndent(db.scopes, "", "  ")
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return db, nil
+	// Write to a temporary file first, so a crash never leaves a partial snapshot behind.
+	file, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err = file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(file.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), filename)
+}
+
+func (db *MemoryDatabase) snapshotLoop(interval time.Duration) {
+	defer close(db.stopped)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// There is nobody to report an error to here. The snapshot will be retried at the
+			// next tick, and Close reports the error of the final snapshot.
+			db.PurgeExpired()
+			db.Snapshot(db.snapshotFile)
+		case <-db.stop:
+			return
+		}
+	}
 }
 
-func (db *JsonDatabase) getScope(name string) *JsonScope {
+// Close stops periodic snapshots, and writes a final snapshot if a snapshot file is set.
+func (db *MemoryDatabase) Close() error {
+	if db.stop != nil {
+		close(db.stop)
+		<-db.stopped
+		db.stop = nil
+	}
+
+	if db.snapshotFile == "" {
+		return nil
+	}
+	return db.Snapshot(db.snapshotFile)
+}
+
+func (db *MemoryDatabase) getScope(name string) *JsonScope {
 	for i := range db.scopes {
 		if db.scopes[i].Name == name {
 			return &db.scopes[i]
@@ -54,7 +292,7 @@ func (db *JsonDatabase) getScope(name string) *JsonScope {
 	return nil
 }
 
-func (db *JsonDatabase) getVariable(scope *JsonScope, name string) *JsonVariable {
+func (db *MemoryDatabase) getVariable(scope *JsonScope, name string) *JsonVariable {
 	for i := range scope.Variables {
 		if scope.Variables[i].Name == name {
 			return &scope.Variables[i]
@@ -63,44 +301,365 @@ func (db *JsonDatabase) getVariable(scope *JsonScope, name string) *JsonVariable
 	return nil
 }
 
-func (db *JsonDatabase) save() error {
-	if db.filename == "" {
-		return nil
+func (db *MemoryDatabase) lookup(name, scope string) (*JsonScope, *JsonVariable) {
+	s := db.getScope(scope)
+	if s == nil {
+		return nil, nil
 	}
+	return s, db.getVariable(s, name)
+}
 
-	data, err := json.MarshalIndent(db.scopes, "", "  ")
-	if err != nil {
-		return err
+// lookupCurrent is like lookup, but ignores variables that have expired.
+func (db *MemoryDatabase) lookupCurrent(name, scope string) (*JsonScope, *JsonVariable) {
+	s, v := db.lookup(name, scope)
+	if v != nil && v.expired(time.Now()) {
+		return s, nil
 	}
-
-	return ioutil.WriteFile(db.filename, data, 0644)
+	return s, v
 }
 
-func (db *JsonDatabase) ReadValue(name, scope string) (string, bool) {
-	s := db.getScope(scope)
-	if s == nil {
-		return "", false
-	}
-	v := db.getVariable(s, name)
+func (db *MemoryDatabase) ReadValue(name, scope string) (string, bool) {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	_, v := db.lookupCurrent(name, scope)
 	if v == nil {
 		return "", false
 	}
 	return v.Value, true
 }
 
-func (db *JsonDatabase) StoreValue(name, scope, value string) error {
+func (db *MemoryDatabase) StoreValue(name, scope, value string) error {
+	return db.StoreRevision(name, scope, Revision{Value: value})
+}
+
+// StoreRevision stores a new revision of a variable. Expired variables are removed at the same
+// time, so they don't pile up in databases without snapshots.
+func (db *MemoryDatabase) StoreRevision(name, scope string, revision Revision) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.purgeExpired()
+	db.storeRevision(name, scope, revision)
+	return nil
+}
+
+func (db *MemoryDatabase) storeRevision(name, scope string, revision Revision) {
 	s := db.getScope(scope)
 	if s == nil {
-		s = &JsonScope{Name: scope}
 		db.scopes = append(db.scopes, JsonScope{Name: scope})
 		s = &db.scopes[len(db.scopes)-1]
 	}
 	v := db.getVariable(s, name)
 	if v == nil {
-		s.Variables = append(s.Variables, JsonVariable{name, value})
+		s.Variables = append(s.Variables, JsonVariable{Name: name})
 		v = &s.Variables[len(s.Variables)-1]
-	} else {
-		v.Value = value
+	} else if v.expired(time.Now()) {
+		*v = JsonVariable{Name: name}
+	} else if v.Value != revision.Value {
+		v.History = append([]JsonRevision{v.current()}, v.History...)
+		if len(v.History) > MaxHistory {
+			v.History = v.History[:MaxHistory]
+		}
+	}
+	v.setCurrent(toJsonRevision(revision))
+}
+
+// ReadHistory returns all known revisions of a variable, starting with the current value.
+func (db *MemoryDatabase) ReadHistory(name, scope string) []Revision {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	_, v := db.lookupCurrent(name, scope)
+	if v == nil {
+		return nil
+	}
+
+	history := []Revision{fromJsonRevision(v.current())}
+	for _, r := range v.History {
+		history = append(history, fromJsonRevision(r))
+	}
+	return history
+}
+
+// UndoValue restores the previous value of a variable. If there is no previous value the
+// variable is removed, and false is returned.
+func (db *MemoryDatabase) UndoValue(name, scope string) (Revision, bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.undoValue(name, scope)
+}
+
+func (db *MemoryDatabase) undoValue(name, scope string) (Revision, bool, error) {
+	s, v := db.lookupCurrent(name, scope)
+	if v == nil {
+		return Revision{}, false, errors.New("undefined variable " + name)
+	}
+
+	if len(v.History) == 0 {
+		db.removeVariable(s, name)
+		return Revision{}, false, nil
+	}
+
+	previous := v.History[0]
+	v.setCurrent(previous)
+	v.History = v.History[1:]
+	return fromJsonRevision(previous), true, nil
+}
+
+// DeleteValue removes a variable and its history.
+func (db *MemoryDatabase) DeleteValue(name, scope string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if s := db.getScope(scope); s != nil {
+		db.removeVariable(s, name)
+	}
+	return nil
+}
+
+func (db *MemoryDatabase) removeVariable(scope *JsonScope, name string) {
+	for i := range scope.Variables {
+		if scope.Variables[i].Name == name {
+			scope.Variables = append(scope.Variables[:i], scope.Variables[i+1:]...)
+			return
+		}
+	}
+}
+
+// LogRoll adds a roll to the log of a scope. Only the last MaxRolls rolls are kept.
+func (db *MemoryDatabase) LogRoll(scope string, roll LoggedRoll) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.logRoll(scope, roll)
+	return nil
+}
+
+func (db *MemoryDatabase) logRoll(scope string, roll LoggedRoll) {
+	s := db.getScope(scope)
+	if s == nil {
+		db.scopes = append(db.scopes, JsonScope{Name: scope})
+		s = &db.scopes[len(db.scopes)-1]
+	}
+
+	s.Rolls = append(s.Rolls, roll.toJson())
+	if len(s.Rolls) > MaxRolls {
+		s.Rolls = s.Rolls[len(s.Rolls)-MaxRolls:]
+	}
+}
+
+// ReadRolls returns the rolls logged in a scope, oldest first.
+func (db *MemoryDatabase) ReadRolls(scope string) []LoggedRoll {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	s := db.getScope(scope)
+	if s == nil {
+		return nil
+	}
+
+	rolls := make([]LoggedRoll, len(s.Rolls))
+	for i, r := range s.Rolls {
+		rolls[i] = fromJsonRoll(r)
+	}
+	return rolls
+}
+
+func (roll LoggedRoll) toJson() JsonRoll {
+	return JsonRoll{
+		UserId:      roll.UserId,
+		UserName:    roll.UserName,
+		ChannelId:   roll.ChannelId,
+		ServerId:    roll.ServerId,
+		Input:       roll.Input,
+		Explanation: roll.Explanation,
+		Result:      roll.Result,
+		Time:        toUnix(roll.Time),
+	}
+}
+
+func fromJsonRoll(r JsonRoll) LoggedRoll {
+	return LoggedRoll{
+		UserId:      r.UserId,
+		UserName:    r.UserName,
+		ChannelId:   r.ChannelId,
+		ServerId:    r.ServerId,
+		Input:       r.Input,
+		Explanation: r.Explanation,
+		Result:      r.Result,
+		Time:        fromUnix(r.Time),
+	}
+}
+
+func (db *MemoryDatabase) ListValues(scope string) []string {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	s := db.getScope(scope)
+	if s == nil {
+		return nil
+	}
+
+	now := time.Now()
+	names := make([]string, 0, len(s.Variables))
+	for _, v := range s.Variables {
+		if !v.expired(now) {
+			names = append(names, v.Name)
+		}
+	}
+	return names
+}
+
+// ListScopes returns the names of the scopes that start with prefix and contain variables.
+func (db *MemoryDatabase) ListScopes(prefix string) []string {
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	var names []string
+	for _, s := range db.scopes {
+		if strings.HasPrefix(s.Name, prefix) && len(s.Variables) > 0 {
+			names = append(names, s.Name)
+		}
+	}
+	return names
+}
+
+// removeVariables removes all variables for which remove returns true, and returns how many
+// variables were removed. The caller must hold the mutex.
+func (db *MemoryDatabase) removeVariables(remove func(v *JsonVariable) bool) int {
+	removed := 0
+	for i := range db.scopes {
+		s := &db.scopes[i]
+		variables := s.Variables[:0]
+		for j := range s.Variables {
+			if remove(&s.Variables[j]) {
+				removed += 1
+			} else {
+				variables = append(variables, s.Variables[j])
+			}
+		}
+		s.Variables = variables
+	}
+	return removed
+}
+
+func (db *MemoryDatabase) purgeExpired() int {
+	now := time.Now()
+	return db.removeVariables(func(v *JsonVariable) bool {
+		return v.expired(now)
+	})
+}
+
+func (db *MemoryDatabase) endSession(session string) int {
+	return db.removeVariables(func(v *JsonVariable) bool {
+		return v.Session == session
+	})
+}
+
+// PurgeExpired removes all variables that have expired.
+func (db *MemoryDatabase) PurgeExpired() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.purgeExpired()
+	return nil
+}
+
+// EndSession removes all variables that were stored for the given session, and returns how
+// many variables were removed.
+func (db *MemoryDatabase) EndSession(session string) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	return db.endSession(session), nil
+}
+
+// save writes the database to its file, after removing expired variables. The caller must
+// hold the mutex.
+func (db *JsonDatabase) save() error {
+	if db.filename == "" {
+		return nil
+	}
+	db.purgeExpired()
+	db.unsavedRolls = 0
+	return db.writeFile(db.filename)
+}
+
+func (db *JsonDatabase) StoreValue(name, scope, value string) error {
+	return db.StoreRevision(name, scope, Revision{Value: value})
+}
+
+func (db *JsonDatabase) StoreRevision(name, scope string, revision Revision) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.storeRevision(name, scope, revision)
+	return db.save()
+}
+
+func (db *JsonDatabase) UndoValue(name, scope string) (Revision, bool, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	revision, found, err := db.undoValue(name, scope)
+	if err != nil {
+		return revision, found, err
+	}
+	return revision, found, db.save()
+}
+
+func (db *JsonDatabase) DeleteValue(name, scope string) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if s := db.getScope(scope); s != nil {
+		db.removeVariable(s, name)
+	}
+	return db.save()
+}
+
+func (db *JsonDatabase) PurgeExpired() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.purgeExpired() == 0 {
+		return nil
+	}
+	return db.save()
+}
+
+func (db *JsonDatabase) EndSession(session string) (int, error) {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	removed := db.endSession(session)
+	if removed == 0 {
+		return 0, nil
+	}
+	return removed, db.save()
+}
+
+func (db *JsonDatabase) LogRoll(scope string, roll LoggedRoll) error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	db.logRoll(scope, roll)
+	db.unsavedRolls += 1
+	if db.unsavedRolls < RollsPerSave {
+		return nil
+	}
+	return db.save()
+}
+
+// Close writes the rolls that were logged since the file was last written.
+func (db *JsonDatabase) Close() error {
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	if db.unsavedRolls == 0 {
+		return nil
 	}
 	return db.save()
 }
@@ -1,25 +1,28 @@
 package dicebot
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var testScopes = []JsonScope{
 	{
 		Name: "test",
 		Variables: []JsonVariable{
-			{"a", "1"},
-			{"b", "2"},
+			{Name: "a", Value: "1"},
+			{Name: "b", Value: "2"},
 		},
 	},
 }
 
 func TestJsonDatabase_ReadValue(t *testing.T) {
 	db := &JsonDatabase{
-		scopes: append([]JsonScope(nil), testScopes...),
+		MemoryDatabase: MemoryDatabase{scopes: append([]JsonScope(nil), testScopes...)},
 	}
 
 	tests := []struct {
@@ -44,7 +47,7 @@ func TestJsonDatabase_ReadValue(t *testing.T) {
 
 func TestJsonDatabase_StoreValue(t *testing.T) {
 	db := &JsonDatabase{
-		scopes: append([]JsonScope(nil), testScopes...),
+		MemoryDatabase: MemoryDatabase{scopes: append([]JsonScope(nil), testScopes...)},
 	}
 
 	tests := []struct {
@@ -153,3 +156,228 @@ func TestJsonDatabase_StoreValueSaves(t *testing.T) {
 		t.Errorf("ReadFile(): expected %v\ngot %v", json, string(data))
 	}
 }
+
+func TestJsonDatabase_History(t *testing.T) {
+	db := &JsonDatabase{}
+
+	for i := 1; i <= MaxHistory+5; i += 1 {
+		err := db.StoreRevision("a", "test", Revision{Value: fmt.Sprintf("%d", i), Author: "user", Time: time.Unix(int64(i), 0)})
+		if err != nil {
+			t.Fatalf("StoreRevision(): %v", err)
+		}
+	}
+
+	history := db.ReadHistory("a", "test")
+	if len(history) != MaxHistory+1 {
+		t.Fatalf("ReadHistory(): expected %d revisions, got %d", MaxHistory+1, len(history))
+	}
+	if history[0].Value != "15" || history[0].Author != "user" || history[0].Time.Unix() != 15 {
+		t.Errorf("ReadHistory(): unexpected current revision %+v", history[0])
+	}
+	if history[MaxHistory].Value != "5" {
+		t.Errorf("ReadHistory(): unexpected oldest revision %+v", history[MaxHistory])
+	}
+
+	if history := db.ReadHistory("x", "test"); history != nil {
+		t.Errorf("ReadHistory(x): expected nil, got %+v", history)
+	}
+}
+
+func TestJsonDatabase_UndoValue(t *testing.T) {
+	db := &JsonDatabase{}
+	db.StoreValue("a", "test", "1")
+	db.StoreValue("a", "test", "2")
+
+	revision, found, err := db.UndoValue("a", "test")
+	if err != nil || !found || revision.Value != "1" {
+		t.Errorf("UndoValue(): got %+v %v %v", revision, found, err)
+	}
+	if value, ok := db.ReadValue("a", "test"); value != "1" || !ok {
+		t.Errorf("ReadValue() after undo: got %v %v", value, ok)
+	}
+
+	_, found, err = db.UndoValue("a", "test")
+	if err != nil || found {
+		t.Errorf("UndoValue(): got %v %v", found, err)
+	}
+	if _, ok := db.ReadValue("a", "test"); ok {
+		t.Errorf("ReadValue() after undo: variable should be removed")
+	}
+
+	if _, _, err = db.UndoValue("a", "test"); err == nil {
+		t.Errorf("UndoValue(): expected error for unknown variable")
+	}
+}
+
+func TestMemoryDatabase_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.json")
+
+	db, err := NewMemoryDatabase(filename, time.Hour)
+	if err != nil {
+		t.Fatalf("NewMemoryDatabase(): %v", err)
+	}
+	db.StoreValue("a", "test", "1")
+
+	if data, _ := ioutil.ReadFile(filename); len(data) != 0 {
+		t.Errorf("StoreValue() should not write snapshot, got %v", string(data))
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+
+	restored, err := NewMemoryDatabase(filename, 0)
+	if err != nil {
+		t.Fatalf("NewMemoryDatabase(): %v", err)
+	}
+	if value, ok := restored.ReadValue("a", "test"); value != "1" || !ok {
+		t.Errorf("ReadValue() after restore: got %v %v", value, ok)
+	}
+}
+
+func TestMemoryDatabase_SnapshotInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test")
+	if err != nil {
+		t.Fatalf("Unable to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "test.json")
+
+	db, err := NewMemoryDatabase(filename, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewMemoryDatabase(): %v", err)
+	}
+	defer db.Close()
+	db.StoreValue("a", "test", "1")
+
+	for i := 0; i < 100; i += 1 {
+		if data, _ := ioutil.ReadFile(filename); len(data) != 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("No snapshot written to %v", filename)
+}
+
+func TestJsonDatabase_Expires(t *testing.T) {
+	db := &JsonDatabase{}
+	db.StoreRevision("a", "test", Revision{Value: "1", Expires: time.Now().Add(-time.Second)})
+	db.StoreRevision("b", "test", Revision{Value: "2", Expires: time.Now().Add(time.Hour)})
+
+	if _, ok := db.ReadValue("a", "test"); ok {
+		t.Errorf("ReadValue() should ignore expired values")
+	}
+	if value, ok := db.ReadValue("b", "test"); value != "2" || !ok {
+		t.Errorf("ReadValue() got %v %v", value, ok)
+	}
+	if names := db.ListValues("test"); !reflect.DeepEqual(names, []string{"b"}) {
+		t.Errorf("ListValues() got %v", names)
+	}
+
+	if err := db.PurgeExpired(); err != nil {
+		t.Fatalf("PurgeExpired(): %v", err)
+	}
+	if variables := db.getScope("test").Variables; len(variables) != 1 || variables[0].Name != "b" {
+		t.Errorf("PurgeExpired() left %+v", variables)
+	}
+}
+
+func TestMemoryDatabase_PurgeOnStore(t *testing.T) {
+	db, err := NewMemoryDatabase("", 0)
+	if err != nil {
+		t.Fatalf("NewMemoryDatabase(): %v", err)
+	}
+	db.StoreRevision("a", "test", Revision{Value: "1", Expires: time.Now().Add(-time.Second)})
+	db.StoreValue("b", "test", "2")
+
+	if variables := db.getScope("test").Variables; len(variables) != 1 || variables[0].Name != "b" {
+		t.Errorf("StoreValue() should remove expired values, left %+v", variables)
+	}
+}
+
+func TestJsonDatabase_EndSession(t *testing.T) {
+	db := &JsonDatabase{}
+	db.StoreRevision("a", "user", Revision{Value: "1", Session: "channel-1"})
+	db.StoreRevision("b", "server", Revision{Value: "2", Session: "channel-1"})
+	db.StoreRevision("c", "user", Revision{Value: "3", Session: "channel-2"})
+	db.StoreValue("d", "user", "4")
+
+	removed, err := db.EndSession("channel-1")
+	if err != nil || removed != 2 {
+		t.Errorf("EndSession() got %v %v", removed, err)
+	}
+	if names := db.ListValues("user"); !reflect.DeepEqual(names, []string{"c", "d"}) {
+		t.Errorf("ListValues() after EndSession() got %v", names)
+	}
+}
+
+func TestJsonDatabase_LogRoll(t *testing.T) {
+	db := &JsonDatabase{}
+	for i := 0; i < MaxRolls+10; i += 1 {
+		if err := db.LogRoll("test", LoggedRoll{Input: "d6", Result: i}); err != nil {
+			t.Fatalf("LogRoll(): %v", err)
+		}
+	}
+
+	rolls := db.ReadRolls("test")
+	if len(rolls) != MaxRolls || rolls[0].Result != 10 || rolls[MaxRolls-1].Result != MaxRolls+9 {
+		t.Errorf("ReadRolls() got %d rolls, from %+v to %+v", len(rolls), rolls[0], rolls[len(rolls)-1])
+	}
+	if rolls := db.ReadRolls("other"); rolls != nil {
+		t.Errorf("ReadRolls(other) got %+v", rolls)
+	}
+}
+
+func TestJsonDatabase_LogRollBatches(t *testing.T) {
+	filename := WriteTempFile(t, "test*.json", "[]")
+	defer os.Remove(filename)
+
+	db, err := NewJsonDatabase(filename)
+	if err != nil {
+		t.Fatalf("NewJsonDatabase(): %v", err)
+	}
+	logged := func() int {
+		restored, err := NewJsonDatabase(filename)
+		if err != nil {
+			t.Fatalf("NewJsonDatabase(): %v", err)
+		}
+		return len(restored.ReadRolls("test"))
+	}
+
+	for i := 0; i < RollsPerSave-1; i += 1 {
+		db.LogRoll("test", LoggedRoll{Input: "d6", Result: i})
+	}
+	if n := logged(); n != 0 {
+		t.Errorf("LogRoll() should not write every roll, found %d rolls", n)
+	}
+	db.LogRoll("test", LoggedRoll{Input: "d6"})
+	if n := logged(); n != RollsPerSave {
+		t.Errorf("LogRoll() should write a batch of %d rolls, found %d", RollsPerSave, n)
+	}
+
+	db.LogRoll("test", LoggedRoll{Input: "d6"})
+	if err := db.Close(); err != nil {
+		t.Fatalf("Close(): %v", err)
+	}
+	if n := logged(); n != RollsPerSave+1 {
+		t.Errorf("Close() should write unsaved rolls, found %d", n)
+	}
+}
+
+func TestMemoryDatabase_ListScopes(t *testing.T) {
+	db := &MemoryDatabase{}
+	db.StoreValue("a", "state-user-1-server-1", "1")
+	db.StoreValue("a", "state-user-2-server-1", "1")
+	db.StoreValue("a", "server-1", "1")
+	db.LogRoll("state-user-3-server-1", LoggedRoll{Input: "d6"})
+
+	expected := []string{"state-user-1-server-1", "state-user-2-server-1"}
+	if scopes := db.ListScopes("state-user-"); !reflect.DeepEqual(scopes, expected) {
+		t.Errorf("ListScopes(): expected %v, got %v", expected, scopes)
+	}
+}
@@ -0,0 +1,233 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MaxCombinations is the number of combinations of outcomes Distribution considers before it
+// gives up.
+const MaxCombinations = 1000000
+
+var errTooManyOutcomes = errors.New("there are too many possible outcomes to work out the distribution")
+
+// Probabilities maps every possible outcome of an expression to its probability.
+type Probabilities map[int]float64
+
+func constant(value int) Probabilities {
+	return Probabilities{value: 1}
+}
+
+func uniform(sides int) Probabilities {
+	probabilities := make(Probabilities, sides)
+	for side := 1; side <= sides; side += 1 {
+		probabilities[side] = 1 / float64(sides)
+	}
+	return probabilities
+}
+
+func (p Probabilities) combine(other Probabilities, operator BinaryFunc) (Probabilities, error) {
+	if len(p)*len(other) > MaxCombinations {
+		return nil, errTooManyOutcomes
+	}
+
+	combined := make(Probabilities)
+	for left, pLeft := range p {
+		for right, pRight := range other {
+			combined[operator(left, right)] += pLeft * pRight
+		}
+	}
+	return combined, nil
+}
+
+// Values returns the possible outcomes in increasing order.
+func (p Probabilities) Values() []int {
+	values := make([]int, 0, len(p))
+	for value := range p {
+		values = append(values, value)
+	}
+	sort.Ints(values)
+	return values
+}
+
+// Mean returns the expected value.
+func (p Probabilities) Mean() float64 {
+	mean := 0.0
+	for value, probability := range p {
+		mean += float64(value) * probability
+	}
+	return mean
+}
+
+func (e *NumberExpr) distribution(lookup Lookup, depth int) (Probabilities, error) {
+	return constant(e.Value), nil
+}
+
+func (e *DiceExpr) distribution(lookup Lookup, depth int) (Probabilities, error) {
+	// The sum of the dice has at most Number * Sides outcomes. Check before building the
+	// outcomes of a single die, which could be huge on its own.
+	if e.Sides > MaxCombinations || float64(e.Number)*float64(e.Sides) > MaxCombinations {
+		return nil, errTooManyOutcomes
+	}
+
+	die := uniform(e.Sides)
+	probabilities := constant(0)
+	for i := 0; i < e.Number; i += 1 {
+		var err error
+		if probabilities, err = probabilities.combine(die, plus); err != nil {
+			return nil, err
+		}
+	}
+	return probabilities, nil
+}
+
+func (e *VariableExpr) distribution(lookup Lookup, depth int) (Probabilities, error) {
+	if err := e.Lookup(lookup); err != nil {
+		return nil, err
+	}
+	return distribution(e.Value, lookup, depth)
+}
+
+// distribution of a "best of" expression tries every combination of rolled dice.
+func (e *BestOfExpr) distribution(lookup Lookup, depth int) (Probabilities, error) {
+	combinations := math.Pow(float64(e.Of.Sides), float64(e.Of.Number))
+	if combinations > MaxCombinations {
+		return nil, errTooManyOutcomes
+	}
+
+	probabilities := make(Probabilities)
+	probability := 1 / combinations
+	rolled := make([]int, e.Of.Number)
+	sorted := make([]int, e.Of.Number)
+	for i := range rolled {
+		rolled[i] = 1
+	}
+	for {
+		copy(sorted, rolled)
+		sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+		t := 0
+		for _, r := range sorted[:e.Number] {
+			t += r
+		}
+		probabilities[t] += probability
+
+		i := 0
+		for i < len(rolled) && rolled[i] == e.Of.Sides {
+			rolled[i] = 1
+			i += 1
+		}
+		if i == len(rolled) {
+			break
+		}
+		rolled[i] += 1
+	}
+	return probabilities, nil
+}
+
+func (e *UnaryExpr) distribution(lookup Lookup, depth int) (Probabilities, error) {
+	value, err := distribution(e.Value, lookup, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	probabilities := make(Probabilities, len(value))
+	for v, probability := range value {
+		probabilities[e.Operator(v)] += probability
+	}
+	return probabilities, nil
+}
+
+func (e *BinaryExpr) distribution(lookup Lookup, depth int) (Probabilities, error) {
+	left, err := distribution(e.Left, lookup, depth)
+	if err != nil {
+		return nil, err
+	}
+	right, err := distribution(e.Right, lookup, depth)
+	if err != nil {
+		return nil, err
+	}
+	if _, zero := right[0]; zero && e.OpName == "/" {
+		return nil, errors.New("the expression could divide by zero")
+	}
+	return left.combine(right, e.Operator)
+}
+
+func (e *ParenExpr) distribution(lookup Lookup, depth int) (Probabilities, error) {
+	return distribution(e.Expr, lookup, depth)
+}
+
+// Distribution works out the probability of every possible outcome of an expression.
+func Distribution(expr Expr, lookup Lookup) (Probabilities, error) {
+	return distribution(expr, lookup, 0)
+}
+
+func distribution(expr Expr, lookup Lookup, depth int) (Probabilities, error) {
+	if depth >= MaxDepth {
+		return nil, ParseError{"Expression too complex", 0}
+	}
+	return expr.distribution(lookup, depth+1)
+}
+
+// distributionBars is the number of bars ShowDistribution shows at most. Outcomes are
+// grouped if there are more.
+const distributionBars = 30
+
+// ShowDistribution shows the probability of every outcome of an expression as a bar chart.
+func (bot *Bot) ShowDistribution(context MessageContext, input string) string {
+	expr, err := ParseString(input)
+	if err != nil {
+		return bot.HandleError(input, err)
+	}
+
+	probabilities, err := Distribution(expr, func(name string) (Expr, error) {
+		return bot.LookupVariable(context, name)
+	})
+	if err != nil {
+		return bot.HandleError(input, err)
+	}
+
+	values := probabilities.Values()
+	min, max := values[0], values[len(values)-1]
+	if max-min < 0 {
+		return bot.HandleError(input, errors.New("the outcomes are too far apart to show"))
+	}
+	width := (max-min)/distributionBars + 1
+
+	type bar struct {
+		label       string
+		probability float64
+	}
+	bars := make([]bar, (max-min)/width+1)
+	for i := range bars {
+		low := min + i*width
+		high := low + width - 1
+		if high > max || high < low {
+			high = max
+		}
+		bars[i].label = fmt.Sprintf("%d", low)
+		if high > low {
+			bars[i].label += fmt.Sprintf("-%d", high)
+		}
+	}
+	for _, value := range values {
+		bars[(value-min)/width].probability += probabilities[value]
+	}
+
+	highest, labelWidth := 0.0, 0
+	for _, b := range bars {
+		highest = math.Max(highest, b.probability)
+		if len(b.label) > labelWidth {
+			labelWidth = len(b.label)
+		}
+	}
+
+	s := fmt.Sprintf("Distribution of %s (average %.2f):\n```\n", EscapeMarkdown(input), probabilities.Mean())
+	for _, b := range bars {
+		length := int(math.Round(20 * b.probability / highest))
+		s += fmt.Sprintf("%*s %6.2f%% %s\n", labelWidth, b.label, 100*b.probability, strings.Repeat("█", length))
+	}
+	return s + "```"
+}
@@ -0,0 +1,116 @@
+package dicebot
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDistribution(t *testing.T) {
+	tests := []struct {
+		input    string
+		outcomes int
+		mean     float64
+	}{
+		{"3", 1, 3},
+		{"d6", 6, 3.5},
+		{"2d6", 11, 7},
+		{"2d6 + 3", 11, 10},
+		{"-d4", 4, -2.5},
+		{"2 * d4", 4, 5},
+		{"best of 2d20", 20, 13.825},
+		{"best 3 of 4d6", 16, 12.2446},
+		{"a + d4", 4, 3.5},
+	}
+
+	lookup := func(name string) (Expr, error) {
+		return &NumberExpr{1}, nil
+	}
+	for _, test := range tests {
+		expr, err := ParseString(test.input)
+		if err != nil {
+			t.Fatalf("ParseString(%q): %v", test.input, err)
+		}
+		probabilities, err := Distribution(expr, lookup)
+		if err != nil {
+			t.Errorf("Distribution(%q): %v", test.input, err)
+			continue
+		}
+
+		total := 0.0
+		for _, probability := range probabilities {
+			total += probability
+		}
+		if math.Abs(total-1) > 1e-9 {
+			t.Errorf("Distribution(%q): probabilities add up to %f", test.input, total)
+		}
+		if len(probabilities) != test.outcomes {
+			t.Errorf("Distribution(%q): expected %d outcomes, got %d", test.input, test.outcomes, len(probabilities))
+		}
+		if math.Abs(probabilities.Mean()-test.mean) > 1e-4 {
+			t.Errorf("Distribution(%q): expected mean %f, got %f", test.input, test.mean, probabilities.Mean())
+		}
+	}
+}
+
+func TestDistribution_errors(t *testing.T) {
+	for _, input := range []string{"d6 / (d2 - 1)", "best of 20d20", "100d20 * 100d20"} {
+		expr, err := ParseString(input)
+		if err != nil {
+			t.Fatalf("ParseString(%q): %v", input, err)
+		}
+		if _, err := Distribution(expr, nil); err == nil {
+			t.Errorf("Distribution(%q) should fail", input)
+		}
+	}
+}
+
+func TestDistribution_hugeDice(t *testing.T) {
+	for _, input := range []string{"d2000000000", "100d20000"} {
+		expr, err := ParseString(input)
+		if err != nil {
+			t.Fatalf("ParseString(%q): %v", input, err)
+		}
+		if _, err := Distribution(expr, nil); err != errTooManyOutcomes {
+			t.Errorf("Distribution(%q): expected %v, got %v", input, errTooManyOutcomes, err)
+		}
+	}
+}
+
+func ExampleBot_ShowDistribution() {
+	fmt.Println(bot.ShowDistribution(context, "2d6"))
+	fmt.Println(bot.ShowDistribution(context, "x"))
+	// Output:
+	// Distribution of 2d6 (average 7.00):
+	// ```
+	//  2   2.78% ███
+	//  3   5.56% ███████
+	//  4   8.33% ██████████
+	//  5  11.11% █████████████
+	//  6  13.89% █████████████████
+	//  7  16.67% ████████████████████
+	//  8  13.89% █████████████████
+	//  9  11.11% █████████████
+	// 10   8.33% ██████████
+	// 11   5.56% ███████
+	// 12   2.78% ███
+	// ```
+	// Sorry, I don't understand how to parse 'x': undefined variable `x`
+}
+
+func TestBot_ShowDistribution_hugeRange(t *testing.T) {
+	for _, input := range []string{"d2*100000000000", "d2*4611686018427387904"} {
+		done := make(chan string)
+		go func() { done <- bot.ShowDistribution(context, input) }()
+		select {
+		case s := <-done:
+			if bars := strings.Count(s, "\n") - 3; bars > distributionBars+1 {
+				t.Errorf("ShowDistribution(%q) shows %d bars", input, bars)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("ShowDistribution(%q) takes too long", input)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package dicebot
+
+import (
+	"errors"
+	"strings"
+)
+
+func parseEdits(context MessageContext, value string) (string, error) {
+	if value != "reroll" && value != "show" && value != "refuse" {
+		return "", errors.New("the value must be `reroll`, `show` or `refuse`")
+	}
+	return value, nil
+}
+
+// HandleEdit handles a message that was edited. The original is the content of the reply
+// to the message before it was edited, or empty if the message was not answered. The
+// responses replace that reply. What happens depends on the "edits" setting of the server:
+//
+//   - reroll: the edited message is handled like a new message.
+//   - show: like reroll, but the original reply is shown as well.
+//   - refuse: commands are not handled again, so the reply is not changed.
+//
+// A message that was not answered before is handled like a new message, unless edits are
+// refused.
+func (bot *Bot) HandleEdit(context MessageContext, msg, original string) Responses {
+	setting := bot.Setting(context, "edits")
+	if setting == "refuse" {
+		return nil
+	}
+
+	responses := bot.HandleMessage(context, msg)
+	if setting == "show" && original != "" && len(responses) > 0 {
+		responses[0].Content = strings.TrimSpace(responses[0].Content + "\n" + quote("Before the edit: "+original))
+	}
+	return responses
+}
+
+// quote formats text as a quote block.
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
+}
@@ -0,0 +1,29 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+func ExampleBot_HandleEdit() {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}}
+
+	original := bot.HandleMessage(context, "!roll d6").String()
+	fmt.Println(original)
+	fmt.Println(bot.HandleEdit(context, "!roll d20", original))
+
+	bot.HandleMessage(context, "!config edits reroll")
+	fmt.Println(bot.HandleEdit(context, "!roll d20", original))
+
+	bot.HandleMessage(context, "!config edits refuse")
+	fmt.Printf("%q\n", bot.HandleEdit(context, "!roll d20", original))
+	fmt.Printf("%q\n", bot.HandleEdit(context, "!roll d20", ""))
+	// Output:
+	// d6 => **6**
+	// d20 => **8**
+	// > Before the edit: d6 => **6**
+	// d20 => **8**
+	// ""
+	// ""
+}
@@ -3,9 +3,8 @@ module github.com/hackedd/dicebot
 go 1.15
 
 require (
+	github.com/BurntSushi/toml v1.2.1
 	github.com/bwmarrin/discordgo v0.25.0
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	github.com/urfave/cli/v2 v2.11.0
-	gopkg.in/yaml.v2 v2.2.2 // indirect
+	gopkg.in/yaml.v2 v2.4.0
 )
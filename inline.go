@@ -0,0 +1,47 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var inlineRoll = regexp.MustCompile(`\[\[(.+?)\]\]`)
+
+func parseOnOff(context MessageContext, value string) (string, error) {
+	if value != "on" && value != "off" {
+		return "", errors.New("the value must be `on` or `off`")
+	}
+	return value, nil
+}
+
+// InlineRolls evaluates all rolls written as `[[expr]]` in a message. It returns the message
+// with the results filled in, followed by an explanation of every roll. If the message does
+// not contain any rolls, an empty string is returned.
+func (bot *Bot) InlineRolls(context MessageContext, msg string) string {
+	if !inlineRoll.MatchString(msg) {
+		return ""
+	}
+
+	text, explanations := bot.rollInline(context, msg, func(input string) string { return input })
+	return context.UserName + ": " + text + "\n" + strings.Join(explanations, "\n")
+}
+
+// rollInline evaluates all rolls written as `[[expr]]` in text, after passing them through
+// prepare. It returns the text with the results filled in, and an explanation of every roll.
+func (bot *Bot) rollInline(context MessageContext, text string, prepare func(string) string) (string, []string) {
+	var explanations []string
+	filled := inlineRoll.ReplaceAllStringFunc(text, func(match string) string {
+		input := prepare(inlineRoll.FindStringSubmatch(match)[1])
+		value, explanation, err := bot.roll(context, input)
+		if err != nil {
+			explanations = append(explanations, bot.HandleError(input, err))
+			return "**?**"
+		}
+
+		explanations = append(explanations, bot.FormatResult(input, value, explanation))
+		return fmt.Sprintf("**%d**", value)
+	})
+	return filled, explanations
+}
@@ -0,0 +1,26 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+func ExampleBot_HandleMessage_inline() {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}}
+
+	fmt.Println(bot.HandleMessage(context, "I swing at it [[d20+5]] for [[2d6+3]]"))
+	fmt.Println(bot.HandleMessage(context, "I cast [[fireball]]"))
+	fmt.Printf("%q\n", bot.HandleMessage(context, "Nothing to roll [[]] here"))
+	fmt.Println(bot.HandleMessage(context, "!config inline off"))
+	fmt.Printf("%q\n", bot.HandleMessage(context, "I swing at it [[d20+5]]"))
+	// Output:
+	// Player: I swing at it **7** for **13**
+	// d20+5 => **2 + 5** => **7**
+	// 2d6+3 => **(4 + 6) + 3** => **13**
+	// Player: I cast **?**
+	// Sorry, I don't understand how to parse 'fireball': undefined variable `fireball`
+	// ""
+	// Changed inline to `off`
+	// ""
+}
@@ -1,70 +1,590 @@
 package dicebot
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
 )
 
+// Outcome is the result of a move when the roll is in Range, like "10+", "7-9", "6-" or "12".
+// XP overrides whether the player marks XP. By default, players mark XP on a miss: an outcome
+// for all rolls up to some value, like "6-".
+//
+// Text is a template: `{value}` is replaced by the result of the roll, `{user}` by the name of
+// the player, rolls like `[[d8+{str}]]` are rolled and `{table:name}` rolls on a table when the
+// outcome is shown.
+type Outcome struct {
+	Range string `json:"range" yaml:"range" toml:"range"`
+	Text  string `json:"text" yaml:"text" toml:"text"`
+	XP    *bool  `json:"xp,omitempty" yaml:"xp,omitempty" toml:"xp,omitempty"`
+	// Hold, Forward and Ongoing are added to the hold for the move, and the forward and ongoing
+	// bonuses of the player.
+	Hold    int `json:"hold,omitempty" yaml:"hold,omitempty" toml:"hold,omitempty"`
+	Forward int `json:"forward,omitempty" yaml:"forward,omitempty" toml:"forward,omitempty"`
+	Ongoing int `json:"ongoing,omitempty" yaml:"ongoing,omitempty" toml:"ongoing,omitempty"`
+}
+
+// Move is a move, like in Powered by the Apocalypse games. The outcome of a roll is the first
+// of the Outcomes whose range matches. Moves without outcomes use the Critical (12+), Hit
+// (10+), Pass (7-9) and Miss (6-) texts instead.
 type Move struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Roll        string `json:"roll"`
-	Hit         string `json:"hit"`
-	Pass        string `json:"pass"`
-	Miss        string `json:"miss"`
+	Name        string    `json:"name" yaml:"name" toml:"name"`
+	Description string    `json:"description" yaml:"description" toml:"description"`
+	Roll        string    `json:"roll" yaml:"roll" toml:"roll"`
+	Hit         string    `json:"hit" yaml:"hit" toml:"hit"`
+	Pass        string    `json:"pass" yaml:"pass" toml:"pass"`
+	Miss        string    `json:"miss" yaml:"miss" toml:"miss"`
+	Critical    string    `json:"critical,omitempty" yaml:"critical,omitempty" toml:"critical,omitempty"`
+	Outcomes    []Outcome `json:"outcomes,omitempty" yaml:"outcomes,omitempty" toml:"outcomes,omitempty"`
+	XPOnMiss    *bool     `json:"xp_on_miss,omitempty" yaml:"xp_on_miss,omitempty" toml:"xp_on_miss,omitempty"`
+	// Playbook is the playbook the move belongs to. Moves without a playbook are basic moves,
+	// that everybody can make.
+	Playbook string `json:"playbook,omitempty" yaml:"playbook,omitempty" toml:"playbook,omitempty"`
+	// Category groups moves in the list of moves. Tags are extra words to search for.
+	Category string   `json:"category,omitempty" yaml:"category,omitempty" toml:"category,omitempty"`
+	Tags     []string `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	// Set is the name of the move set the move was loaded from.
+	Set string `json:"-" yaml:"-" toml:"-"`
+}
+
+// moveFile is a file with moves and settings for all of them. A file can also contain just a
+// list of moves.
+type moveFile struct {
+	XPOnMiss *bool  `json:"xp_on_miss" yaml:"xp_on_miss" toml:"xp_on_miss"`
+	Moves    []Move `json:"moves" yaml:"moves" toml:"moves"`
 }
 
+// LoadMoves loads moves from a JSON, YAML or TOML file, depending on the extension of the
+// filename. The rolls of all moves are checked, so mistakes are found before they are used.
 func LoadMoves(moves map[string]Move, filename string) error {
 	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return err
 	}
 
-	var moveList []Move
-	err = json.Unmarshal(data, &moveList)
+	moveList, err := parseMoves(filename, data)
 	if err != nil {
 		return err
 	}
-
 	for _, move := range moveList {
-		moves[strings.ToLower(move.Name)] = move
+		moves[move.key()] = move
+	}
+	return nil
+}
+
+// setName returns the name of the move set in a file: the filename without directory and
+// extension.
+func setName(filename string) string {
+	base := filepath.Base(filename)
+	return strings.ToLower(strings.TrimSuffix(base, filepath.Ext(base)))
+}
+
+// decodeFile decodes a JSON, YAML or TOML file, depending on the extension of the filename.
+// Files that contain a list are decoded into list, others into file. Unknown keys are errors in
+// every format, so misspelled keys are found when the file is loaded.
+func decodeFile(filename string, data []byte, list, file interface{}) error {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return err
+		}
+		if _, ok := document.([]interface{}); ok {
+			return yaml.UnmarshalStrict(data, list)
+		}
+		return yaml.UnmarshalStrict(data, file)
+	case ".toml":
+		metadata, err := toml.Decode(string(data), file)
+		if err != nil {
+			return err
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return errors.New(fmt.Sprintf("unknown key `%s`", undecoded[0]))
+		}
+		return nil
+	default:
+		if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+			return decodeJSON(data, file)
+		}
+		return decodeJSON(data, list)
 	}
+}
 
+// decodeJSON decodes JSON like json.Unmarshal, but does not allow unknown keys.
+func decodeJSON(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return errors.New("unexpected data after the end of the file")
+	}
 	return nil
 }
 
-func (bot *Bot) MakeMove(context MessageContext, moveName string) (output string) {
-	move, ok := bot.moves[strings.ToLower(moveName)]
-	if !ok {
-		return bot.HandleError(moveName, errors.New("unknown move"))
+// parseMoves parses a move file. The format depends on the extension of the filename.
+func parseMoves(filename string, data []byte) ([]Move, error) {
+	var file moveFile
+	if err := decodeFile(filename, data, &file.Moves, &file); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", filename, err))
+	}
+
+	for i := range file.Moves {
+		move := &file.Moves[i]
+		if move.XPOnMiss == nil {
+			move.XPOnMiss = file.XPOnMiss
+		}
+		move.Set = setName(filename)
+		if err := move.validate(); err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: move %s: %s", filename, move.Name, err))
+		}
+	}
+	return file.Moves, nil
+}
+
+// key returns the key of a move in a map of moves. Moves with the same name can be loaded
+// from different sets.
+func (move Move) key() string {
+	if move.Set == "" {
+		return strings.ToLower(move.Name)
 	}
+	return move.Set + ":" + strings.ToLower(move.Name)
+}
 
-	output = fmt.Sprintf("%s makes a move: %s!\n", context.UserName, move.Name)
-	output += move.Description + "\n"
+// validate checks the roll and outcomes of a move.
+func (move Move) validate() error {
+	if move.Name == "" {
+		return errors.New("the move has no name")
+	}
 	if move.Roll != "" {
-		value, explanation, err := bot.Eval(context, move.Roll)
-		if err != nil {
-			output += bot.HandleError(move.Roll, err)
-			return
+		if _, err := ParseString(placeholder.ReplaceAllString(move.Roll, "$1")); err != nil {
+			return errors.New(fmt.Sprintf("invalid roll `%s`: %s", move.Roll, err))
+		}
+	}
+	for _, outcome := range move.outcomes() {
+		if _, _, err := parseRange(outcome.Range); err != nil {
+			return err
+		}
+		for _, match := range inlineRoll.FindAllStringSubmatch(outcome.Text, -1) {
+			roll := strings.ReplaceAll(match[1], "{value}", "0")
+			if _, err := ParseString(placeholder.ReplaceAllString(roll, "$1")); err != nil {
+				return errors.New(fmt.Sprintf("invalid roll `%s` in outcome %s: %s", match[1], outcome.Range, err))
+			}
+		}
+	}
+	return nil
+}
+
+// parseRange parses the range of an outcome.
+func parseRange(s string) (min, max int, err error) {
+	min, max = math.MinInt32, math.MaxInt32
+	switch {
+	case s == "":
+		err = errors.New("empty range")
+	case strings.HasSuffix(s, "+"):
+		min, err = strconv.Atoi(s[:len(s)-1])
+	case strings.HasSuffix(s, "-"):
+		max, err = strconv.Atoi(s[:len(s)-1])
+	case strings.Contains(s[1:], "-"):
+		i := strings.Index(s[1:], "-") + 1
+		if min, err = strconv.Atoi(s[:i]); err == nil {
+			max, err = strconv.Atoi(s[i+1:])
+		}
+	default:
+		min, err = strconv.Atoi(s)
+		max = min
+	}
+	if err != nil || min > max {
+		err = errors.New(fmt.Sprintf("invalid range `%s`", s))
+	}
+	return
+}
+
+// outcomes returns the outcomes of a move.
+func (move Move) outcomes() []Outcome {
+	if move.Outcomes != nil {
+		return move.Outcomes
+	}
+
+	var outcomes []Outcome
+	if move.Critical != "" {
+		outcomes = append(outcomes, Outcome{Range: "12+", Text: move.Critical})
+	}
+	return append(outcomes,
+		Outcome{Range: "10+", Text: move.Hit},
+		Outcome{Range: "7-9", Text: move.Pass},
+		Outcome{Range: "6-", Text: move.Miss},
+	)
+}
+
+// outcome returns the outcome for a roll, and whether the player marks XP.
+func (move Move) outcome(value int) (Outcome, bool, bool) {
+	for _, outcome := range move.outcomes() {
+		min, max, err := parseRange(outcome.Range)
+		if err != nil || value < min || value > max {
+			continue
+		}
+
+		xp := min == math.MinInt32 && (move.XPOnMiss == nil || *move.XPOnMiss)
+		if outcome.XP != nil {
+			xp = *outcome.XP
+		}
+		return outcome, xp, true
+	}
+	return Outcome{}, false, false
+}
+
+// ListMoves lists the moves a user can make, grouped by category, with the first sentence of
+// their description.
+func (bot *Bot) ListMoves(context MessageContext) string {
+	moves := bot.availableMoves(context)
+	if len(moves) == 0 {
+		return "I don't know any moves."
+	}
+	return "I know the following moves:\n" + formatMoves(moves)
+}
+
+// formatMoves formats a list of moves. If any of the moves has a category, the moves are
+// grouped by category, and moves without category are listed last.
+func formatMoves(moves []Move) string {
+	categories := false
+	for _, move := range moves {
+		categories = categories || move.Category != ""
+	}
+	if categories {
+		moves = append([]Move(nil), moves...)
+		sort.SliceStable(moves, func(i, j int) bool {
+			a, b := moves[i].Category, moves[j].Category
+			if a == "" || b == "" {
+				return a != "" && b == ""
+			}
+			return strings.ToLower(a) < strings.ToLower(b)
+		})
+	}
+
+	s := ""
+	for i, move := range moves {
+		if categories && (i == 0 || !strings.EqualFold(move.Category, moves[i-1].Category)) {
+			category := move.Category
+			if category == "" {
+				category = "Other moves"
+			}
+			s += "**" + EscapeMarkdown(category) + "**\n"
+		}
+		s += " * " + EscapeMarkdown(move.Name)
+		if summary := move.summary(); summary != "" {
+			s += ": " + EscapeMarkdown(summary)
+		}
+		s += "\n"
+	}
+	return s
+}
+
+// MaxSummaryLength is the length of the longest description shown in the list of moves.
+const MaxSummaryLength = 80
+
+// summary returns the first sentence of the description of a move, shortened to
+// MaxSummaryLength.
+func (move Move) summary() string {
+	summary := strings.TrimSpace(move.Description)
+	if i := strings.IndexByte(summary, '\n'); i >= 0 {
+		summary = summary[:i]
+	}
+	if i := strings.Index(summary, ". "); i >= 0 {
+		summary = summary[:i+1]
+	}
+	if runes := []rune(summary); len(runes) > MaxSummaryLength {
+		summary = strings.TrimSpace(string(runes[:MaxSummaryLength-1])) + "…"
+	}
+	return summary
+}
+
+// SearchMoves lists the moves a user can make whose name, description, category or tags
+// contain text.
+func (bot *Bot) SearchMoves(context MessageContext, text string) string {
+	needle := strings.ToLower(strings.TrimSpace(text))
+
+	var moves []Move
+	for _, move := range bot.availableMoves(context) {
+		haystack := strings.ToLower(strings.Join(append([]string{move.Name, move.Description, move.Category}, move.Tags...), "\n"))
+		if strings.Contains(haystack, needle) {
+			moves = append(moves, move)
 		}
+	}
+	if len(moves) == 0 {
+		return fmt.Sprintf("No moves match `%s`.", text)
+	}
+	return fmt.Sprintf("Moves matching `%s`:\n", text) + formatMoves(moves)
+}
+
+// MoveInfo describes a move and its outcomes, without rolling.
+func (bot *Bot) MoveInfo(context MessageContext, name string) Response {
+	move, modifier, found := bot.findMove(context, name)
+	if !found || modifier != "" {
+		return Response{Content: bot.HandleError("move info "+name, bot.unknownMove(context, name))}
+	}
+
+	embed := &Embed{Title: truncate(move.Name, MaxTitleLength)}
+	embed.setDescription(move.Description)
+	if move.Roll != "" {
+		embed.addField("Roll", "`"+move.Roll+"`", true)
+	}
+	if move.Category != "" {
+		embed.addField("Category", EscapeMarkdown(move.Category), true)
+	}
+	if move.Playbook != "" {
+		embed.addField("Playbook", EscapeMarkdown(move.Playbook), true)
+	}
+	if len(move.Tags) > 0 {
+		embed.addField("Tags", EscapeMarkdown(strings.Join(move.Tags, ", ")), true)
+	}
+	if move.Roll != "" {
+		for _, outcome := range move.outcomes() {
+			if outcome.Text != "" && !embed.addField(outcome.Range, outcome.Text, false) {
+				break
+			}
+		}
+	}
+	return Response{Embed: embed}
+}
+
+// moveChoices returns the moves a user can make whose name contains value. Names that start
+// with value come first.
+func moveChoices(bot *Bot, context MessageContext, value string) []Choice {
+	var names []string
+	for _, move := range bot.availableMoves(context) {
+		names = append(names, move.Name)
+	}
+	return nameChoices(names, value)
+}
+
+// MaxSuggestions is the number of moves suggested for an unknown move.
+const MaxSuggestions = 3
 
-		output += bot.FormatResult(move.Roll, value, explanation) + "\n"
+// unknownMove returns the error for a move that was not found, suggesting moves with a
+// similar name.
+func (bot *Bot) unknownMove(context MessageContext, text string) error {
+	type suggestion struct {
+		name     string
+		distance int
+	}
 
-		if value >= 10 && move.Hit != "" {
-			output += move.Hit + "\n"
+	lower := strings.ToLower(strings.TrimSpace(text))
+	words := strings.Fields(lower)
+	var suggestions []suggestion
+	for _, move := range bot.availableMoves(context) {
+		name := strings.ToLower(move.Name)
+		// Compare with as many words as the name has, so modifiers don't count.
+		prefix := lower
+		if n := len(strings.Fields(name)); n < len(words) {
+			prefix = strings.Join(words[:n], " ")
 		}
-		if value >= 7 && value <= 9 && move.Pass != "" {
-			output += move.Pass + "\n"
+
+		distance := levenshtein(prefix, name)
+		if distance <= len([]rune(name))/3 || len(prefix) >= 3 && strings.HasPrefix(name, prefix) {
+			suggestions = append(suggestions, suggestion{move.Name, distance})
 		}
-		if value < 7 {
-			if move.Miss != "" {
-				output += move.Miss + " "
+	}
+	if len(suggestions) == 0 {
+		return errors.New("unknown move")
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].distance < suggestions[j].distance
+	})
+	if len(suggestions) > MaxSuggestions {
+		suggestions = suggestions[:MaxSuggestions]
+	}
+	names := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		names[i] = "`" + suggestion.name + "`"
+	}
+	if len(names) > 1 {
+		names = []string{strings.Join(names[:len(names)-1], ", "), names[len(names)-1]}
+	}
+	return errors.New("unknown move, did you mean " + strings.Join(names, " or ") + "?")
+}
+
+// levenshtein returns the number of runes that have to be inserted, removed or replaced to
+// turn a into b.
+func levenshtein(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	row := make([]int, len(t)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		previous := row[0]
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
 			}
-			output += "Mark XP.\n"
+			current := row[j]
+			row[j] = min3(row[j]+1, row[j-1]+1, previous+cost)
+			previous = current
 		}
 	}
+	return row[len(t)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
+
+// findMove finds the move with the longest name that text starts with. The rest of the text
+// is returned as modifier.
+func (bot *Bot) findMove(context MessageContext, text string) (move Move, modifier string, found bool) {
+	longest := -1
+	for _, m := range bot.availableMoves(context) {
+		length := utf8.RuneCountInString(m.Name)
+		if length <= longest {
+			continue
+		}
+		end := prefixLength(text, length)
+		if end < 0 || !strings.EqualFold(text[:end], m.Name) {
+			continue
+		}
+		if r, _ := utf8.DecodeRuneInString(text[end:]); end < len(text) && isWordRune(r) {
+			continue
+		}
+		move, modifier, found, longest = m, strings.TrimSpace(text[end:]), true, length
+	}
 	return
 }
+
+// prefixLength returns the length in bytes of the first n runes of s, or -1 if s is shorter.
+func prefixLength(s string, n int) int {
+	for i := range s {
+		if n == 0 {
+			return i
+		}
+		n--
+	}
+	if n == 0 {
+		return len(s)
+	}
+	return -1
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+var placeholder = regexp.MustCompile(`\{(\w+)\}`)
+
+// rollWith combines the roll of a move with a modifier. If the roll contains a placeholder
+// like `{stat}`, a modifier that starts with a term (like `dex` or `dex +1`) fills it in.
+// Placeholders that are not filled in are looked up as variables.
+func (move Move) rollWith(modifier string) string {
+	roll := move.Roll
+	if modifier != "" && !strings.ContainsAny(modifier[:1], "+-*/") {
+		if match := placeholder.FindStringIndex(roll); match != nil {
+			term := modifier
+			if i := strings.IndexAny(modifier, " +-*/"); i >= 0 {
+				term = modifier[:i]
+			}
+			roll = roll[:match[0]] + term + roll[match[1]:]
+			modifier = strings.TrimSpace(modifier[len(term):])
+		} else {
+			modifier = "+" + modifier
+		}
+	}
+
+	roll = placeholder.ReplaceAllString(roll, "$1")
+	if modifier != "" {
+		roll += " " + modifier
+	}
+	return roll
+}
+
+// fillOutcome fills in the template of an outcome text, see Outcome. Rolls are made like the
+// roll of the move, so placeholders in them are looked up as variables. The explanations of
+// the rolls are returned separately.
+func (bot *Bot) fillOutcome(context MessageContext, text string, value int) (string, []string) {
+	text = strings.ReplaceAll(text, "{value}", strconv.Itoa(value))
+	text, rolls := bot.fillTables(context, &tableRolls{}, text, 0, func(input string) string {
+		return placeholder.ReplaceAllString(input, "$1")
+	})
+	// The name is filled in last, so a name like `[[100d100]]` is not rolled.
+	return strings.ReplaceAll(text, "{user}", EscapeMarkdown(context.UserName)), rolls
+}
+
+// MakeMove makes the move text starts with. The rest of the text is a modifier for the roll,
+// see Move.rollWith.
+func (bot *Bot) MakeMove(context MessageContext, text string) Response {
+	move, modifier, ok := bot.findMove(context, text)
+	if !ok {
+		return Response{Content: bot.HandleError(text, bot.unknownMove(context, text))}
+	}
+
+	embed := &Embed{Title: truncate(fmt.Sprintf("%s makes a move: %s!", context.UserName, move.Name), MaxTitleLength)}
+	embed.setDescription(move.Description)
+	response := Response{Embed: embed, ReplyTo: context.MessageId}
+	if move.Roll == "" {
+		return response
+	}
+
+	roll, bonuses := bot.withBonuses(context, move.rollWith(modifier), true)
+	value, explanation, err := bot.rollWithBonuses(context, move.rollWith(modifier), roll)
+	if err != nil {
+		embed.addField("Error", bot.HandleError(roll, err), false)
+		return response
+	}
+	embed.addField("Roll", bot.FormatResult(roll, value, explanation), false)
+	if bonuses != "" {
+		bot.useForward(context)
+		embed.addField("Bonuses", "Including "+bonuses+".", false)
+	}
+
+	if outcome, xp, found := move.outcome(value); found {
+		text, rolls := bot.fillOutcome(context, outcome.Text, value)
+		if xp {
+			text = strings.TrimSpace(truncate(text, MaxFieldLength-len(" Mark XP.")) + " Mark XP.")
+		}
+		if text != "" {
+			embed.addField("Outcome", text, false)
+		}
+		if len(rolls) > 0 {
+			embed.addField("Rolls", strings.Join(rolls, "\n"), false)
+		}
+
+		if xp {
+			if s, err := bot.AddXP(context, 1); err != nil {
+				embed.addField("Error", bot.HandleError("xp +1", err), false)
+			} else {
+				embed.addField("XP", s, false)
+			}
+		}
+
+		gained, err := bot.gain(context, move, outcome)
+		if err != nil {
+			embed.addField("Error", bot.HandleError(move.Name, err), false)
+		} else if gained != "" {
+			embed.addField("Gained", "You gain "+gained+".", false)
+		}
+	}
+	return response
+}
@@ -3,6 +3,7 @@ package dicebot
 import (
 	"fmt"
 	"log"
+	"math"
 	"math/rand"
 	"os"
 	"reflect"
@@ -46,11 +47,24 @@ func TestLoadMoves(t *testing.T) {
 		t.Fatalf("LoadMoves(%v): %v", filename, err)
 	}
 
-	if !reflect.DeepEqual(moves, botWithMoves.moves) {
-		t.Errorf("NewJsonDatabase(): expected %+v got %+v", botWithMoves.moves, moves)
+	expected := botWithMoves.moves["move"]
+	expected.Set = setName(filename)
+	if !reflect.DeepEqual(moves, map[string]Move{expected.Set + ":move": expected}) {
+		t.Errorf("LoadMoves(): expected %+v got %+v", expected, moves)
 	}
 }
 
+// moveNamed returns the move with a name from a map of moves, ignoring the set.
+func moveNamed(moves map[string]Move, name string) Move {
+	for _, move := range moves {
+		if move.Name == name {
+			move.Set = ""
+			return move
+		}
+	}
+	return Move{}
+}
+
 func ExampleBot_MakeMove_unknown() {
 	fmt.Println(botWithMoves.MakeMove(context, "Unknown"))
 	// Output:
@@ -111,6 +125,7 @@ func ExampleBot_MakeMove_miss() {
 	// When you do a thing, roll+Str.
 	// 2d6+Str => **(6 + 4) + -4** => **6**
 	// The thing went terribly wrong. Mark XP.
+	// You have 1 XP.
 }
 
 func ExampleBot_MakeMove_noRoll() {
@@ -159,15 +174,583 @@ func ExampleBot_MakeMove_noOutcomes() {
 }
 
 func TestBot_HandleMessage_move(t *testing.T) {
-	got := botWithMoves.HandleMessage(context, "!move Move")
+	got := botWithMoves.HandleMessage(context, "!move Move").String()
 	if strings.Index(got, "Player makes a move:") != 0 {
 		t.Errorf("HandleMessage should make a move, got %v", got)
 	}
 }
 
 func TestBot_HandleMessage_listMoves(t *testing.T) {
-	got := botWithMoves.HandleMessage(context, "!move")
+	got := botWithMoves.HandleMessage(context, "!move").String()
 	if strings.Index(got, "I know the following moves") == -1 || strings.Index(got, "Move") == -1 {
 		t.Errorf("HandleMessage should list moves, got %v", got)
 	}
 }
+
+func TestBot_MakeMove_embed(t *testing.T) {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}, moves: botWithMoves.moves}
+	context := context
+	context.MessageId = "message"
+
+	err := bot.db.StoreValue("str", "user-user", "1")
+	if err != nil {
+		t.Fatalf("StoreValue(str): %v", err)
+	}
+
+	response := bot.MakeMove(context, "Move")
+	expected := &Embed{
+		Title:       "Player makes a move: Move!",
+		Description: "When you do a thing, roll+Str.",
+		Fields: []EmbedField{
+			{Name: "Roll", Value: "2d6+Str => **(6 + 4) + 1** => **11**"},
+			{Name: "Outcome", Value: "You successfully did the thing!"},
+		},
+	}
+	if !reflect.DeepEqual(response.Embed, expected) {
+		t.Errorf("MakeMove(): expected embed %+v, got %+v", expected, response.Embed)
+	}
+	if response.ReplyTo != "message" {
+		t.Errorf("MakeMove(): expected reply to message, got %q", response.ReplyTo)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		input    string
+		min, max int
+		valid    bool
+	}{
+		{"10+", 10, math.MaxInt32, true},
+		{"7-9", 7, 9, true},
+		{"6-", math.MinInt32, 6, true},
+		{"12", 12, 12, true},
+		{"-1-3", -1, 3, true},
+		{"", 0, 0, false},
+		{"9-7", 0, 0, false},
+		{"lots", 0, 0, false},
+	}
+
+	for _, test := range tests {
+		min, max, err := parseRange(test.input)
+		if !test.valid {
+			if err == nil {
+				t.Errorf("parseRange(%q) should fail", test.input)
+			}
+			continue
+		}
+		if err != nil || min != test.min || max != test.max {
+			t.Errorf("parseRange(%q): expected %d, %d, got %d, %d, %v", test.input, test.min, test.max, min, max, err)
+		}
+	}
+}
+
+func TestLoadMoves_outcomes(t *testing.T) {
+	json := `{
+  "xp_on_miss": false,
+  "moves": [
+    {
+      "name": "Action",
+      "roll": "best of 2d6",
+      "outcomes": [
+        {"range": "6", "text": "You do it."},
+        {"range": "4-5", "text": "You do it, but there's a consequence."},
+        {"range": "3-", "text": "Things go badly."}
+      ]
+    },
+    {"name": "Move", "roll": "2d6", "miss": "Oops.", "xp_on_miss": true}
+  ]
+}
+`
+
+	filename := WriteTempFile(t, "test*.json", json)
+	defer os.Remove(filename)
+
+	moves := make(map[string]Move)
+	if err := LoadMoves(moves, filename); err != nil {
+		t.Fatalf("LoadMoves(%v): %v", filename, err)
+	}
+
+	if outcome, xp, _ := moveNamed(moves, "Action").outcome(2); outcome.Text != "Things go badly." || xp {
+		t.Errorf("outcome(2): expected a bad outcome without XP, got %+v, %v", outcome, xp)
+	}
+	if outcome, _, _ := moveNamed(moves, "Action").outcome(5); outcome.Range != "4-5" {
+		t.Errorf("outcome(5): expected a partial success, got %+v", outcome)
+	}
+	if outcome, xp, _ := moveNamed(moves, "Move").outcome(4); outcome.Text != "Oops." || !xp {
+		t.Errorf("outcome(4): expected a miss with XP, got %+v, %v", outcome, xp)
+	}
+
+	filename = WriteTempFile(t, "test*.json", `[{"name": "Move", "outcomes": [{"range": "lots"}]}]`)
+	defer os.Remove(filename)
+	if err := LoadMoves(moves, filename); err == nil {
+		t.Errorf("LoadMoves(%v) should fail for an invalid range", filename)
+	}
+}
+
+func ExampleBot_MakeMove_critical() {
+	rand.Seed(1)
+
+	bot := &Bot{
+		db: &JsonDatabase{},
+		moves: map[string]Move{
+			"move": {
+				Name:     "Move",
+				Roll:     "2d6+2",
+				Hit:      "You did it.",
+				Critical: "You did it, and then some.",
+			},
+		},
+	}
+
+	fmt.Println(bot.MakeMove(context, "Move"))
+	// Output:
+	// Player makes a move: Move!
+	// 2d6+2 => **(6 + 4) + 2** => **12**
+	// You did it, and then some.
+}
+
+func ExampleMove_rollWith() {
+	move := Move{Roll: "2d6"}
+	stat := Move{Roll: "2d6+{stat}"}
+
+	fmt.Println(move.rollWith(""))
+	fmt.Println(move.rollWith("+1"))
+	fmt.Println(move.rollWith("dex"))
+	fmt.Println(stat.rollWith(""))
+	fmt.Println(stat.rollWith("dex"))
+	fmt.Println(stat.rollWith("dex +1"))
+	fmt.Println(stat.rollWith("-1"))
+	// Output:
+	// 2d6
+	// 2d6 +1
+	// 2d6 +dex
+	// 2d6+stat
+	// 2d6+dex
+	// 2d6+dex +1
+	// 2d6+stat -1
+}
+
+func ExampleBot_MakeMove_modifier() {
+	rand.Seed(1)
+
+	bot := &Bot{
+		db: &JsonDatabase{},
+		moves: map[string]Move{
+			"defy": {Name: "Defy", Roll: "2d6"},
+			"defy danger": {
+				Name: "Defy Danger",
+				Roll: "2d6+{stat}",
+				Hit:  "You do what you set out to.",
+				Pass: "You stumble, hesitate, or flinch.",
+			},
+		},
+	}
+	bot.db.StoreValue("dex", "user-user", "2")
+	bot.db.StoreValue("stat", "user-user", "-1")
+
+	fmt.Println(bot.MakeMove(context, "defy danger dex +1"))
+	fmt.Println(bot.MakeMove(context, "Defy Danger"))
+	fmt.Println(bot.MakeMove(context, "defy dangerously"))
+	// Output:
+	// Player makes a move: Defy Danger!
+	// 2d6+dex +1 => **(6 + 4) + 2 + 1** => **13**
+	// You do what you set out to.
+	// Player makes a move: Defy Danger!
+	// 2d6+stat => **(6 + 6) + -1** => **11**
+	// You do what you set out to.
+	// Player makes a move: Defy!
+	// Sorry, I don't understand how to parse '2d6 +dangerously': undefined variable `dangerously`
+}
+
+func TestLoadMoves_formats(t *testing.T) {
+	yaml := `xp_on_miss: false
+moves:
+  - name: Move
+    description: When you do a thing, roll+Str.
+    roll: 2d6+{stat}
+    outcomes:
+      - range: 10+
+        text: You do it.
+        hold: 2
+`
+	list := `- name: Move
+  roll: 2d6+{stat}
+`
+	toml := `xp_on_miss = false
+
+[[moves]]
+name = "Move"
+description = "When you do a thing, roll+Str."
+roll = "2d6+{stat}"
+
+[[moves.outcomes]]
+range = "10+"
+text = "You do it."
+hold = 2
+`
+	xpOnMiss := false
+	expected := Move{
+		Name:        "Move",
+		Description: "When you do a thing, roll+Str.",
+		Roll:        "2d6+{stat}",
+		Outcomes:    []Outcome{{Range: "10+", Text: "You do it.", Hold: 2}},
+		XPOnMiss:    &xpOnMiss,
+	}
+
+	for _, test := range []struct {
+		pattern, content string
+		expected         Move
+	}{
+		{"test*.yaml", yaml, expected},
+		{"test*.yml", list, Move{Name: "Move", Roll: "2d6+{stat}"}},
+		{"test*.toml", toml, expected},
+	} {
+		filename := WriteTempFile(t, test.pattern, test.content)
+		defer os.Remove(filename)
+
+		moves := make(map[string]Move)
+		if err := LoadMoves(moves, filename); err != nil {
+			t.Errorf("LoadMoves(%v): %v", filename, err)
+			continue
+		}
+		if !reflect.DeepEqual(moveNamed(moves, "Move"), test.expected) {
+			t.Errorf("LoadMoves(%v): expected %+v, got %+v", filename, test.expected, moveNamed(moves, "Move"))
+		}
+	}
+}
+
+func TestLoadMoves_invalidRoll(t *testing.T) {
+	filename := WriteTempFile(t, "test*.json", `[{"name": "Move", "roll": "2d6+"}]`)
+	defer os.Remove(filename)
+
+	err := LoadMoves(make(map[string]Move), filename)
+	expected := filename + ": move Move: invalid roll `2d6+`: Unexpected input near position 4"
+	if err == nil || err.Error() != expected {
+		t.Errorf("LoadMoves(%v): expected error %q, got %v", filename, expected, err)
+	}
+}
+
+func TestBot_ReloadMoves(t *testing.T) {
+	bot, _ := NewBot()
+	good := WriteTempFile(t, "test*.json", `[{"name": "Move", "roll": "2d6"}]`)
+	defer os.Remove(good)
+	bad := WriteTempFile(t, "test*.json", `[{"name": "Other", "roll": "2d"}]`)
+	defer os.Remove(bad)
+
+	if err := bot.ReloadMoves(good); err != nil {
+		t.Fatalf("ReloadMoves(%v): %v", good, err)
+	}
+	if err := bot.ReloadMoves(good, bad); err == nil {
+		t.Errorf("ReloadMoves(%v, %v) should fail", good, bad)
+	}
+	if _, _, found := bot.findMove(context, "move"); !found {
+		t.Errorf("ReloadMoves() should keep the moves if a file can't be loaded")
+	}
+}
+
+var botWithCategories = &Bot{
+	db: &JsonDatabase{},
+	moves: map[string]Move{
+		"hack and slash": {
+			Name:        "Hack and Slash",
+			Description: "When you attack an enemy in melee, roll+Str. On a 10+, you deal your damage.",
+			Roll:        "2d6+Str",
+			Hit:         "You deal your damage and avoid their attack.",
+			Miss:        "The GM makes a move.",
+			Category:    "Basic moves",
+			Tags:        []string{"combat"},
+		},
+		"defy danger": {
+			Name:        "Defy Danger",
+			Description: "When you act despite an imminent threat, say how you deal with it and roll.",
+			Roll:        "2d6+{stat}",
+			Category:    "Basic moves",
+		},
+		"last breath": {
+			Name:        "Last Breath",
+			Description: "When you're dying you catch a glimpse of what lies beyond the Black Gates.",
+			Roll:        "2d6",
+			Category:    "Special moves",
+		},
+		"make camp": {Name: "Make Camp"},
+	},
+}
+
+func ExampleBot_ListMoves_categories() {
+	fmt.Println(botWithCategories.ListMoves(context))
+	// Output:
+	// I know the following moves:
+	// **Basic moves**
+	//  * Defy Danger: When you act despite an imminent threat, say how you deal with it and roll.
+	//  * Hack and Slash: When you attack an enemy in melee, roll+Str.
+	// **Special moves**
+	//  * Last Breath: When you're dying you catch a glimpse of what lies beyond the Black Gates.
+	// **Other moves**
+	//  * Make Camp
+}
+
+func ExampleBot_HandleMessage_moveSearch() {
+	fmt.Println(botWithCategories.HandleMessage(context, "!move search combat"))
+	fmt.Println(botWithCategories.HandleMessage(context, "!move search dying"))
+	fmt.Println(botWithCategories.HandleMessage(context, "!move search sleep"))
+	// Output:
+	// Moves matching `combat`:
+	// **Basic moves**
+	//  * Hack and Slash: When you attack an enemy in melee, roll+Str.
+	//
+	// Moves matching `dying`:
+	// **Special moves**
+	//  * Last Breath: When you're dying you catch a glimpse of what lies beyond the Black Gates.
+	//
+	// No moves match `sleep`.
+}
+
+func ExampleBot_HandleMessage_moveInfo() {
+	fmt.Println(botWithCategories.HandleMessage(context, "!move info hack and slash"))
+	fmt.Println(botWithCategories.HandleMessage(context, "!move info hack and slash +1"))
+	// Output:
+	// Hack and Slash
+	// When you attack an enemy in melee, roll+Str. On a 10+, you deal your damage.
+	// `2d6+Str`
+	// Basic moves
+	// combat
+	// You deal your damage and avoid their attack.
+	// The GM makes a move.
+	// Sorry, I don't understand how to parse 'move info hack and slash +1': unknown move, did you mean `Hack and Slash`?
+}
+
+func ExampleBot_MakeMove_suggestions() {
+	fmt.Println(botWithCategories.MakeMove(context, "hack and slsh +1"))
+	fmt.Println(botWithCategories.MakeMove(context, "defy"))
+	fmt.Println(botWithCategories.MakeMove(context, "make"))
+	fmt.Println(botWithCategories.MakeMove(context, "sleep"))
+	// Output:
+	// Sorry, I don't understand how to parse 'hack and slsh +1': unknown move, did you mean `Hack and Slash`?
+	// Sorry, I don't understand how to parse 'defy': unknown move, did you mean `Defy Danger`?
+	// Sorry, I don't understand how to parse 'make': unknown move, did you mean `Make Camp`?
+	// Sorry, I don't understand how to parse 'sleep': unknown move
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"move", "", 4},
+		{"", "move", 4},
+		{"move", "move", 0},
+		{"move", "mvoe", 2},
+		{"kitten", "sitting", 3},
+		{"défi", "defi", 1},
+	}
+
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.expected {
+			t.Errorf("levenshtein(%q, %q): expected %d, got %d", test.a, test.b, test.expected, got)
+		}
+	}
+}
+
+func ExampleBot_Autocomplete() {
+	fmt.Println(botWithCategories.Autocomplete(context, "move", "name", "d"))
+	fmt.Println(botWithCategories.Autocomplete(context, "move", "name", "MA"))
+	fmt.Println(botWithCategories.Autocomplete(context, "move", "modifier", "d"))
+	fmt.Println(botWithCategories.Autocomplete(context, "unknown", "name", "d"))
+	// Output:
+	// [{Defy Danger Defy Danger} {Hack and Slash Hack and Slash}]
+	// [{Make Camp Make Camp}]
+	// []
+	// []
+}
+
+func TestBot_Autocomplete_activeSets(t *testing.T) {
+	bot := &Bot{
+		db: &JsonDatabase{},
+		moves: map[string]Move{
+			"dungeon-world:hack and slash": {Name: "Hack and Slash", Set: "dungeon-world"},
+			"motw:kick some ass":           {Name: "Kick Some Ass", Set: "motw"},
+		},
+	}
+	if err := bot.SetSetting(context, "moves", "motw"); err != nil {
+		t.Fatalf("SetSetting(moves): %v", err)
+	}
+
+	expected := []Choice{{"Kick Some Ass", "Kick Some Ass"}}
+	if got := bot.Autocomplete(context, "move", "name", ""); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Autocomplete(): expected %v, got %v", expected, got)
+	}
+}
+
+func ExampleBot_MakeMove_template() {
+	rand.Seed(1)
+
+	bot := &Bot{
+		db: &JsonDatabase{},
+		moves: map[string]Move{
+			"hack and slash": {
+				Name: "Hack and Slash",
+				Roll: "2d6+{str}",
+				Hit:  "{user} rolled {value} and deals [[d8+{str}]] damage.",
+				Pass: "You deal [[d8]] damage, but take [[d6+{value}-7]] in return.",
+				Miss: "Roll [[d6]] on the table below.",
+			},
+		},
+	}
+	bot.db.StoreValue("str", "user-user", "1")
+
+	fmt.Println(bot.MakeMove(context, "hack and slash"))
+	fmt.Println(bot.MakeMove(context, "hack and slash -1"))
+	fmt.Println(bot.MakeMove(context, "hack and slash -6"))
+	// Output:
+	// Player makes a move: Hack and Slash!
+	// 2d6+str => **(6 + 4) + 1** => **11**
+	// Player rolled 11 and deals **9** damage.
+	// d8+str => **8 + 1** => **9**
+	// Player makes a move: Hack and Slash!
+	// 2d6+str -1 => **(6 + 2) + 1 - 1** => **8**
+	// You deal **7** damage, but take **3** in return.
+	// d8 => **7**
+	// d6+8-7 => **2 + 8 - 7** => **3**
+	// Player makes a move: Hack and Slash!
+	// 2d6+str -6 => **(3 + 5) + 1 - 6** => **3**
+	// Roll **1** on the table below. Mark XP.
+	// d6 => **1**
+	// You have 1 XP.
+}
+
+func TestLoadMoves_invalidTemplate(t *testing.T) {
+	filename := WriteTempFile(t, "test*.json", `[{"name": "Move", "roll": "2d6", "hit": "You deal [[d8+]] damage."}]`)
+	defer os.Remove(filename)
+
+	err := LoadMoves(make(map[string]Move), filename)
+	if err == nil || !strings.Contains(err.Error(), "invalid roll `d8+` in outcome 10+") {
+		t.Errorf("LoadMoves(%v) should fail for an invalid roll in an outcome, got %v", filename, err)
+	}
+}
+
+func TestBot_MoveInfo_limits(t *testing.T) {
+	move := Move{Name: "Long", Roll: "d100", Description: strings.Repeat("Long description. ", 300)}
+	for i := 1; i <= 100; i += 1 {
+		move.Outcomes = append(move.Outcomes, Outcome{Range: fmt.Sprint(i), Text: strings.Repeat("x", 2000)})
+	}
+	bot := &Bot{db: &JsonDatabase{}, moves: map[string]Move{"long": move}}
+
+	embed := bot.MoveInfo(context, "long").Embed
+	if n := len([]rune(embed.Description)); n > MaxDescriptionLength {
+		t.Errorf("MoveInfo(): description has %d characters", n)
+	}
+	if len(embed.Fields) == 0 || len(embed.Fields) > MaxFields {
+		t.Errorf("MoveInfo(): got %d fields", len(embed.Fields))
+	}
+	for _, field := range embed.Fields {
+		if n := len([]rune(field.Value)); n > MaxFieldLength {
+			t.Errorf("MoveInfo(): field %s has %d characters", field.Name, n)
+		}
+	}
+	if n := embed.length(); n > MaxEmbedLength {
+		t.Errorf("MoveInfo(): embed has %d characters", n)
+	}
+}
+
+func TestBot_MakeMove_userName(t *testing.T) {
+	bot := &Bot{
+		db:     &JsonDatabase{},
+		moves:  map[string]Move{"greet": {Name: "Greet", Roll: "1", Outcomes: []Outcome{{Range: "1", Text: "Hello {user}."}}}},
+		tables: botWithTables.tables,
+	}
+
+	for _, name := range []string{"[[100d1000000]]", "{table:loop}"} {
+		player := context
+		player.UserName = name
+		embed := bot.MakeMove(player, "greet").Embed
+		for _, field := range embed.Fields {
+			if field.Name == "Rolls" {
+				t.Errorf("MakeMove(%s): name was rolled: %s", name, field.Value)
+			}
+			if field.Name == "Outcome" && field.Value != "Hello "+name+"." {
+				t.Errorf("MakeMove(%s): got outcome %s", name, field.Value)
+			}
+		}
+	}
+}
+
+func TestBot_MakeMove_limits(t *testing.T) {
+	bot := &Bot{
+		db: &JsonDatabase{},
+		moves: map[string]Move{"long": {
+			Name:     "Long",
+			Roll:     "1",
+			Outcomes: []Outcome{{Range: "1", Text: strings.Repeat("[[d6]] ", 300)}},
+		}},
+	}
+
+	embed := bot.MakeMove(context, "long").Embed
+	for _, field := range embed.Fields {
+		if n := len([]rune(field.Value)); n > MaxFieldLength {
+			t.Errorf("MakeMove(): field %s has %d characters", field.Name, n)
+		}
+	}
+	if n := embed.length(); n > MaxEmbedLength {
+		t.Errorf("MakeMove(): embed has %d characters", n)
+	}
+}
+
+func TestBot_findMove_unicode(t *testing.T) {
+	bot := &Bot{
+		db: &JsonDatabase{},
+		moves: map[string]Move{
+			"ⱥrcane strike": {Name: "Ⱥrcane Strike", Roll: "2d6"},
+			"i̇stanbul":     {Name: "İstanbul", Roll: "2d6"},
+			"hack":          {Name: "Hack", Roll: "2d6"},
+		},
+	}
+
+	tests := []struct {
+		text, name, modifier string
+	}{
+		{"Ⱥrcane Strike", "Ⱥrcane Strike", ""},
+		{"ⱥrcane strike +1", "Ⱥrcane Strike", "+1"},
+		{"İstanbul", "İstanbul", ""},
+		{"İstanbul str", "İstanbul", "str"},
+		{"hack +1", "Hack", "+1"},
+		{"hackée", "", ""},
+		{"hack", "Hack", ""},
+	}
+	for _, test := range tests {
+		move, modifier, found := bot.findMove(context, test.text)
+		if found != (test.name != "") || move.Name != test.name || modifier != test.modifier {
+			t.Errorf("findMove(%q): expected %q %q, got %q %q", test.text, test.name, test.modifier, move.Name, modifier)
+		}
+	}
+}
+
+func TestParseMoves_unknownKeys(t *testing.T) {
+	tests := []struct {
+		filename, content string
+	}{
+		{"test.json", `[{"name": "Move", "roll": "2d6", "outcome": []}]`},
+		{"test.json", `{"moves": [{"name": "Move"}], "xp_on_mis": true}`},
+		{"test.json", `[{"name": "Move"}] []`},
+		{"test.yaml", "- name: Move\n  outcome: []\n"},
+		{"test.toml", "[[moves]]\nname = \"Move\"\noutcome = []\n"},
+		{"test.toml", "xp_on_mis = true\n[[moves]]\nname = \"Move\"\n"},
+	}
+
+	for _, test := range tests {
+		if _, err := parseMoves(test.filename, []byte(test.content)); err == nil {
+			t.Errorf("parseMoves(%v, %q) should fail", test.filename, test.content)
+		}
+	}
+
+	for _, filename := range []string{"test.json", "test.yaml", "test.toml"} {
+		content := `{"moves": [{"name": "Move", "outcomes": [{"range": "10+", "text": "Yes"}]}]}`
+		if filename == "test.toml" {
+			content = "[[moves]]\nname = \"Move\"\n[[moves.outcomes]]\nrange = \"10+\"\ntext = \"Yes\"\n"
+		}
+		if _, err := parseMoves(filename, []byte(content)); err != nil {
+			t.Errorf("parseMoves(%v): %v", filename, err)
+		}
+	}
+}
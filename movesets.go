@@ -0,0 +1,246 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// movesScope is the scope of the move files uploaded for a server, by filename.
+func (context MessageContext) movesScope() string {
+	return "moves-server-" + context.ServerId
+}
+
+func parseMoveSets(context MessageContext, value string) (string, error) {
+	if value == "all" {
+		return value, nil
+	}
+
+	var sets []string
+	for _, set := range strings.Split(value, ",") {
+		set = strings.ToLower(strings.TrimSpace(set))
+		if set == "" || strings.IndexFunc(set, isSpace) >= 0 {
+			return "", errors.New("the value must be `all` or a list of move sets, like `dungeon-world,homebrew`")
+		}
+		sets = append(sets, set)
+	}
+	return strings.Join(sets, ","), nil
+}
+
+// attachments returns the files attached to a message.
+func (context MessageContext) attachments() ([]Attachment, error) {
+	if context.Attachments == nil {
+		return nil, nil
+	}
+	return context.Attachments()
+}
+
+// uploadedMoves returns the moves uploaded for a server.
+func (bot *Bot) uploadedMoves(context MessageContext) []Move {
+	var moves []Move
+	for _, file := range bot.uploaded(context, moveUploads) {
+		moves = append(moves, file.([]Move)...)
+	}
+	return moves
+}
+
+// allMoves returns the moves that were loaded, and the moves uploaded for a server.
+func (bot *Bot) allMoves(context MessageContext) []Move {
+	bot.movesMutex.RLock()
+	moves := make([]Move, 0, len(bot.moves))
+	for _, move := range bot.moves {
+		moves = append(moves, move)
+	}
+	bot.movesMutex.RUnlock()
+
+	moves = append(moves, bot.uploadedMoves(context)...)
+	sort.SliceStable(moves, func(i, j int) bool {
+		if moves[i].Name != moves[j].Name {
+			return moves[i].Name < moves[j].Name
+		}
+		return moves[i].Set < moves[j].Set
+	})
+	return moves
+}
+
+// activeSets returns a function that tells whether a move set is active on the server a
+// message was sent on.
+func (bot *Bot) activeSets(context MessageContext) func(set string) bool {
+	setting := bot.Setting(context, "moves")
+	sets := strings.Split(setting, ",")
+	return func(set string) bool {
+		return setting == "all" || indexOfString(sets, set) >= 0
+	}
+}
+
+// availableMoves returns the moves a user can make: the basic moves and the moves of their
+// playbook, from the move sets that are active on the server.
+func (bot *Bot) availableMoves(context MessageContext) []Move {
+	playbook := bot.Playbook(context)
+	active := bot.activeSets(context)
+
+	var moves []Move
+	for _, move := range bot.allMoves(context) {
+		if move.Set != "" && !active(move.Set) {
+			continue
+		}
+		if move.Playbook != "" && !strings.EqualFold(move.Playbook, playbook) {
+			continue
+		}
+		moves = append(moves, move)
+	}
+	return moves
+}
+
+// Playbooks returns the playbooks of the move sets that are active on a server.
+func (bot *Bot) Playbooks(context MessageContext) []string {
+	active := bot.activeSets(context)
+	var playbooks []string
+	for _, move := range bot.allMoves(context) {
+		if move.Playbook == "" || (move.Set != "" && !active(move.Set)) {
+			continue
+		}
+		if indexOfString(playbooks, move.Playbook) < 0 {
+			playbooks = append(playbooks, move.Playbook)
+		}
+	}
+	sort.Strings(playbooks)
+	return playbooks
+}
+
+// Playbook returns the playbook a user selected on a server.
+func (bot *Bot) Playbook(context MessageContext) string {
+	playbook, _ := bot.db.ReadValue("playbook", context.stateScope())
+	return playbook
+}
+
+// SetPlaybook selects the playbook of a user. An empty name removes the playbook.
+func (bot *Bot) SetPlaybook(context MessageContext, name string) error {
+	if name == "" {
+		return bot.db.DeleteValue("playbook", context.stateScope())
+	}
+
+	for _, playbook := range bot.Playbooks(context) {
+		if strings.EqualFold(playbook, name) {
+			return bot.db.StoreValue("playbook", context.stateScope(), playbook)
+		}
+	}
+	return errors.New(fmt.Sprintf("unknown playbook `%s`", name))
+}
+
+// MoveSets describes the move sets that were loaded and uploaded.
+func (bot *Bot) MoveSets(context MessageContext) string {
+	var sets []string
+	for _, move := range bot.allMoves(context) {
+		if move.Set != "" && indexOfString(sets, move.Set) < 0 {
+			sets = append(sets, move.Set)
+		}
+	}
+	if len(sets) == 0 {
+		return "There are no move sets."
+	}
+	sort.Strings(sets)
+
+	active := bot.activeSets(context)
+	s := "Move sets:\n"
+	for _, set := range sets {
+		s += " * " + EscapeMarkdown(set)
+		if active(set) {
+			s += " (active)"
+		}
+		s += "\n"
+	}
+	return s
+}
+
+// loadedSet returns whether a move set was loaded from a file, rather than uploaded.
+func (bot *Bot) loadedSet(set string) bool {
+	bot.movesMutex.RLock()
+	defer bot.movesMutex.RUnlock()
+
+	for _, move := range bot.moves {
+		if move.Set == set {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadMoves stores a move file for the server a message was sent on. The format depends on
+// the extension of the filename.
+func (bot *Bot) UploadMoves(context MessageContext, filename, content string) error {
+	return bot.upload(context, moveUploads, filename, content)
+}
+
+// RemoveMoves removes a move set that was uploaded for a server.
+func (bot *Bot) RemoveMoves(context MessageContext, set string) error {
+	return bot.removeUpload(context, moveUploads, set)
+}
+
+func playbookHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	name := args["name"]
+	if name == "" {
+		s := "You don't have a playbook."
+		if playbook := bot.Playbook(context); playbook != "" {
+			s = "Your playbook is " + EscapeMarkdown(playbook) + "."
+		}
+		if playbooks := bot.Playbooks(context); len(playbooks) > 0 {
+			s += " Available playbooks: " + EscapeMarkdown(strings.Join(playbooks, ", ")) + "."
+		}
+		return reply(s)
+	}
+
+	if strings.EqualFold(name, "none") {
+		name = ""
+	}
+	if err := bot.SetPlaybook(context, name); err != nil {
+		return reply(bot.HandleError("playbook "+args["name"], err))
+	}
+	if name == "" {
+		return reply("Removed your playbook.")
+	}
+	return reply("Your playbook is now " + EscapeMarkdown(bot.Playbook(context)) + ".")
+}
+
+func movesetHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	action, value := args["action"], strings.TrimSpace(args["value"])
+	text := strings.TrimSpace("moveset " + action + " " + value)
+
+	switch action {
+	case "":
+		return reply(bot.MoveSets(context))
+	case "use":
+		if err := bot.SetSetting(context, "moves", value); err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		return reply(bot.MoveSets(context))
+	case "remove":
+		if err := bot.RemoveMoves(context, value); err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		return reply(fmt.Sprintf("Removed move set `%s`", value))
+	}
+
+	// Move files are uploaded as attachments, or as the name of the set followed by JSON.
+	files, err := context.attachments()
+	if err != nil {
+		return reply(bot.HandleError(text, err))
+	}
+	if value != "" {
+		name, content := splitCommand(value)
+		files = []Attachment{{Name: name + ".json", Content: content}}
+	}
+	if len(files) == 0 {
+		return reply(bot.HandleError(text, errors.New("attach a move file, or type `!moveset upload <name> <json>`")))
+	}
+
+	var names []string
+	for _, file := range files {
+		if err := bot.UploadMoves(context, file.Name, file.Content); err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		names = append(names, "`"+setName(file.Name)+"`")
+	}
+	return reply("Uploaded move set " + strings.Join(names, ", "))
+}
@@ -0,0 +1,144 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func ExampleBot_HandleMessage_moveset() {
+	bot := &Bot{
+		db:          &JsonDatabase{},
+		permissions: DefaultPermissions(),
+		moves: map[string]Move{
+			"dungeon-world:hack and slash": {Name: "Hack and Slash", Set: "dungeon-world"},
+			"dungeon-world:turn undead":    {Name: "Turn Undead", Playbook: "Cleric", Set: "dungeon-world"},
+			"dungeon-world:cast a spell":   {Name: "Cast a Spell", Playbook: "Wizard", Set: "dungeon-world"},
+			"motw:kick some ass":           {Name: "Kick Some Ass", Set: "motw"},
+		},
+	}
+	admin := context
+	admin.Permissions = PermissionManageGuild
+
+	fmt.Println(bot.HandleMessage(context, "!moveset"))
+	fmt.Println(bot.HandleMessage(context, "!moveset use dungeon-world"))
+	fmt.Println(bot.HandleMessage(admin, "!moveset use dungeon-world"))
+	fmt.Println(bot.HandleMessage(context, "!move"))
+	fmt.Println(bot.HandleMessage(context, "!playbook"))
+	fmt.Println(bot.HandleMessage(context, "!playbook bard"))
+	fmt.Println(bot.HandleMessage(context, "!playbook wizard"))
+	fmt.Println(bot.HandleMessage(context, "!move"))
+	fmt.Println(bot.HandleMessage(context, "!move turn undead"))
+	fmt.Println(bot.HandleMessage(admin, `!moveset upload homebrew [{"name": "Brew", "roll": "2d6+", "playbook": "Brewer"}]`))
+	fmt.Println(bot.HandleMessage(admin, `!moveset upload homebrew [{"name": "Brew", "playbook": "Brewer"}]`))
+	fmt.Println(bot.HandleMessage(admin, "!moveset use dungeon-world, homebrew"))
+	fmt.Println(bot.HandleMessage(context, "!playbook"))
+	fmt.Println(bot.HandleMessage(admin, "!moveset remove homebrew"))
+	fmt.Println(bot.HandleMessage(context, "!playbook none"))
+	// Output:
+	// Move sets:
+	//  * dungeon-world (active)
+	//  * motw (active)
+	//
+	// Sorry, you don't have permission to change the configuration
+	// Move sets:
+	//  * dungeon-world (active)
+	//  * motw
+	//
+	// I know the following moves:
+	//  * Hack and Slash
+	//
+	// You don't have a playbook. Available playbooks: Cleric, Wizard.
+	// Sorry, I don't understand how to parse 'playbook bard': unknown playbook `bard`
+	// Your playbook is now Wizard.
+	// I know the following moves:
+	//  * Cast a Spell
+	//  * Hack and Slash
+	//
+	// Sorry, I don't understand how to parse 'turn undead': unknown move
+	// Sorry, I don't understand how to parse 'moveset upload homebrew [{"name": "Brew", "roll": "2d6+", "playbook": "Brewer"}]': homebrew.json: move Brew: invalid roll `2d6+`: Unexpected input near position 4
+	// Uploaded move set `homebrew`
+	// Move sets:
+	//  * dungeon-world (active)
+	//  * homebrew (active)
+	//  * motw
+	//
+	// Your playbook is Wizard. Available playbooks: Brewer, Cleric, Wizard.
+	// Removed move set `homebrew`
+	// Removed your playbook.
+}
+
+func ExampleBot_UploadMoves() {
+	bot := &Bot{
+		db:          &JsonDatabase{},
+		permissions: DefaultPermissions(),
+		limits:      Limits{Variables: map[string]int{"moves": 2}},
+		moves:       map[string]Move{"motw:kick some ass": {Name: "Kick Some Ass", Set: "motw"}},
+	}
+	admin := context
+	admin.Permissions = PermissionManageGuild
+	admin.Attachments = func() ([]Attachment, error) {
+		return []Attachment{{Name: "homebrew.yaml", Content: "- name: Brew\n"}}, nil
+	}
+
+	fmt.Println(bot.HandleMessage(admin, "!moveset upload"))
+	fmt.Println(bot.HandleMessage(admin, "!move"))
+	fmt.Println(bot.HandleMessage(admin, `!moveset upload homebrew [{"name": "Stew"}]`))
+	fmt.Println(bot.HandleMessage(admin, `!moveset upload motw [{"name": "Stew"}]`))
+	fmt.Println(bot.HandleMessage(admin, `!moveset upload extra [{"name": "Stew"}]`))
+	fmt.Println(bot.HandleMessage(admin, `!moveset upload more [{"name": "Stew"}]`))
+	fmt.Println(bot.HandleMessage(admin, "!move"))
+	fmt.Println(bot.HandleMessage(admin, "!moveset remove homebrew"))
+	fmt.Println(bot.HandleMessage(admin, "!move"))
+	fmt.Println(bot.db.ReadHistory("extra.json", admin.movesScope())[0].Value)
+	// Output:
+	// Uploaded move set `homebrew`
+	// I know the following moves:
+	//  * Brew
+	//  * Kick Some Ass
+	//
+	// Sorry, I don't understand how to parse 'moveset upload homebrew [{"name": "Stew"}]': move set `homebrew` was already uploaded as `homebrew.yaml`
+	// Sorry, I don't understand how to parse 'moveset upload motw [{"name": "Stew"}]': there already is a move set `motw`
+	// Uploaded move set `extra`
+	// Sorry, you can't upload more than 2 move files
+	// I know the following moves:
+	//  * Brew
+	//  * Kick Some Ass
+	//  * Stew
+	//
+	// Removed move set `homebrew`
+	// I know the following moves:
+	//  * Kick Some Ass
+	//  * Stew
+	//
+	// [{"name": "Stew"}]
+}
+
+func TestBot_UploadMoves_noHistory(t *testing.T) {
+	bot := &Bot{db: &JsonDatabase{}}
+	for _, content := range []string{`[{"name": "A"}]`, `[{"name": "B"}]`} {
+		if err := bot.UploadMoves(context, "homebrew.json", content); err != nil {
+			t.Fatalf("UploadMoves(): %v", err)
+		}
+	}
+	if history := bot.db.ReadHistory("homebrew.json", context.movesScope()); len(history) != 1 {
+		t.Errorf("UploadMoves() should not keep old versions, got %+v", history)
+	}
+	if moves := bot.uploadedMoves(context); len(moves) != 1 || moves[0].Name != "B" {
+		t.Errorf("uploadedMoves() should return the new moves, got %+v", moves)
+	}
+}
+
+func TestBot_HandleMessage_attachmentError(t *testing.T) {
+	bot := &Bot{db: &JsonDatabase{}}
+	context := context
+	context.Attachments = func() ([]Attachment, error) {
+		return nil, errors.New("unable to download homebrew.json")
+	}
+
+	got := bot.HandleMessage(context, "!moveset upload").String()
+	if !strings.Contains(got, "unable to download homebrew.json") {
+		t.Errorf("HandleMessage() should show the download error, got %q", got)
+	}
+}
@@ -3,6 +3,7 @@ package dicebot
 import (
 	"fmt"
 	"math/rand"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,6 +30,8 @@ type Expr interface {
 	String() string
 	eval(lookup Lookup, depth int) (int, error)
 	explain(lookup Lookup, depth int) string
+	distribution(lookup Lookup, depth int) (Probabilities, error)
+	size() int
 }
 
 type NumberExpr struct {
@@ -85,6 +88,10 @@ func (e *NumberExpr) explain(lookup Lookup, depth int) string {
 	return e.String()
 }
 
+func (e *NumberExpr) size() int {
+	return 1
+}
+
 func (e *DiceExpr) String() string {
 	return fmt.Sprintf("%dd%d", e.Number, e.Sides)
 }
@@ -124,6 +131,10 @@ func (e *DiceExpr) explain(lookup Lookup, depth int) string {
 	return fmt.Sprintf("(%s)", strings.Join(parts, " + "))
 }
 
+func (e *DiceExpr) size() int {
+	return 1
+}
+
 func (e *VariableExpr) String() string {
 	return e.Name
 }
@@ -158,6 +169,10 @@ func (e *VariableExpr) explain(lookup Lookup, depth int) string {
 	return "undef"
 }
 
+func (e *VariableExpr) size() int {
+	return 1
+}
+
 func (e *BestOfExpr) String() string {
 	if e.Number == 1 {
 		return fmt.Sprintf("best of %s", e.Of)
@@ -220,6 +235,10 @@ func (e *BestOfExpr) explain(lookup Lookup, depth int) string {
 	}
 }
 
+func (e *BestOfExpr) size() int {
+	return 1 + e.Of.size()
+}
+
 func (e *UnaryExpr) String() string {
 	return fmt.Sprintf("(%s %s)", e.OpName, e.Value.String())
 }
@@ -236,6 +255,10 @@ func (e *UnaryExpr) explain(lookup Lookup, depth int) string {
 	return fmt.Sprintf("%s%s", e.OpName, explain(e.Value, lookup, depth))
 }
 
+func (e *UnaryExpr) size() int {
+	return 1 + e.Value.size()
+}
+
 func (e *BinaryExpr) String() string {
 	return fmt.Sprintf("(%s %s %s)", e.OpName, e.Left.String(), e.Right.String())
 }
@@ -256,6 +279,10 @@ func (e *BinaryExpr) explain(lookup Lookup, depth int) string {
 	return fmt.Sprintf("%s %s %s", explain(e.Left, lookup, depth), e.OpName, explain(e.Right, lookup, depth))
 }
 
+func (e *BinaryExpr) size() int {
+	return 1 + e.Left.size() + e.Right.size()
+}
+
 func (e *ParenExpr) String() string {
 	return e.Expr.String()
 }
@@ -268,6 +295,10 @@ func (e *ParenExpr) explain(lookup Lookup, depth int) string {
 	return fmt.Sprintf("(%s)", explain(e.Expr, lookup, depth))
 }
 
+func (e *ParenExpr) size() int {
+	return 1 + e.Expr.size()
+}
+
 type nudFunc func(parser *Parser, token Token) (Expr, error)
 type ledFunc func(parser *Parser, token Token, left Expr) (Expr, error)
 
@@ -498,6 +529,33 @@ func Explain(expr Expr, lookup Lookup) string {
 	return explain(expr, lookup, 0)
 }
 
+// rollList matches the list of rolls in an explanation, like "(6 + 3 + 1)" or the rolls of a
+// "best of", like "(__6__, 3, 1)".
+var rollList = regexp.MustCompile(`\((?:_*\d+_*(?: \+ |, ))+_*\d+_*\)`)
+
+// AbbreviateExplanation shortens every list of rolls in an explanation to its first keep
+// rolls, like "(6 + 3 + … 94 more)".
+func AbbreviateExplanation(explanation string, keep int) string {
+	return rollList.ReplaceAllStringFunc(explanation, func(list string) string {
+		separator := " + "
+		if strings.Contains(list, ", ") {
+			separator = ", "
+		}
+
+		rolls := strings.Split(list[1:len(list)-1], separator)
+		if len(rolls) <= keep+1 {
+			return list
+		}
+		more := fmt.Sprintf("… %d more", len(rolls)-keep)
+		return "(" + strings.Join(append(rolls[:keep], more), separator) + ")"
+	})
+}
+
+// Size returns the number of nodes in an expression, without resolving variables.
+func Size(expr Expr) int {
+	return expr.size()
+}
+
 func eval(expr Expr, lookup Lookup, depth int) (int, error) {
 	if depth >= MaxDepth {
 		return 0, ParseError{"Expression too complex", 0}
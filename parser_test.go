@@ -171,3 +171,36 @@ func TestExplain(t *testing.T) {
 		}
 	}
 }
+
+func TestSize(t *testing.T) {
+	tests := []struct {
+		input string
+		size  int
+	}{
+		{"1", 1},
+		{"2d6 + str", 3},
+		{"-(1 + 2) * 3", 7},
+		{"best 2 of 3d6", 2},
+	}
+
+	for _, test := range tests {
+		expr, err := ParseString(test.input)
+		if err != nil {
+			t.Errorf("Parsing '%s' failed: %s", test.input, err)
+			continue
+		}
+		if size := Size(expr); size != test.size {
+			t.Errorf("Size(%s) got %d expected %d", test.input, size, test.size)
+		}
+	}
+}
+
+func ExampleAbbreviateExplanation() {
+	fmt.Println(AbbreviateExplanation("(6 + 3 + 1 + 4 + 2) + 5", 2))
+	fmt.Println(AbbreviateExplanation("best 2 of (__6__, 3, 1, __4__)", 2))
+	fmt.Println(AbbreviateExplanation("(6 + 3 + 1)", 2))
+	// Output:
+	// (6 + 3 + … 3 more) + 5
+	// best 2 of (__6__, 3, … 2 more)
+	// (6 + 3 + 1)
+}
@@ -0,0 +1,107 @@
+package dicebot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Discord permission bits used by the default permission rules.
+const (
+	PermissionAdministrator  int64 = 1 << 3
+	PermissionManageChannels int64 = 1 << 4
+	PermissionManageGuild    int64 = 1 << 5
+)
+
+// PermissionRule grants access to users that have any of the listed permission bits, or any
+// of the listed roles. A rule without permissions or roles grants access to everyone.
+type PermissionRule struct {
+	Permissions int64
+	Roles       []string
+}
+
+// Permissions maps a scope type ("user", "channel" or "server") to the rule that decides who
+// may change variables in scopes of that type. The "config" rule decides who may change the
+// settings of a server. Anything without a rule is unrestricted.
+type Permissions map[string]PermissionRule
+
+type PermissionError struct {
+	Action string
+}
+
+func (e PermissionError) Error() string {
+	return "you don't have permission to " + e.Action
+}
+
+func DefaultPermissions() Permissions {
+	return Permissions{
+		"channel": {Permissions: PermissionAdministrator | PermissionManageChannels},
+		"server":  {Permissions: PermissionAdministrator | PermissionManageGuild},
+		"config":  {Permissions: PermissionAdministrator | PermissionManageGuild},
+	}
+}
+
+// AddRole allows users with the given role to do what the named rules restrict. Without
+// names, the role is added to all rules.
+func (p Permissions) AddRole(role string, names ...string) {
+	for name, rule := range p {
+		if len(names) > 0 && indexOfString(names, name) < 0 {
+			continue
+		}
+		rule.Roles = append(rule.Roles, role)
+		p[name] = rule
+	}
+}
+
+func indexOfString(arr []string, needle string) int {
+	for i, element := range arr {
+		if element == needle {
+			return i
+		}
+	}
+	return -1
+}
+
+func (rule PermissionRule) Allows(context MessageContext) bool {
+	if rule.Permissions == 0 && len(rule.Roles) == 0 {
+		return true
+	}
+
+	if context.Permissions&rule.Permissions != 0 {
+		return true
+	}
+
+	for _, role := range rule.Roles {
+		for _, r := range context.Roles {
+			if strings.EqualFold(role, r) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// checkRule returns a PermissionError if the named rule does not allow the user to do action.
+func (bot *Bot) checkRule(context MessageContext, name, action string) error {
+	rule, ok := bot.permissions[name]
+	if !ok || rule.Allows(context) {
+		return nil
+	}
+	return PermissionError{action}
+}
+
+// checkGM returns a PermissionError unless the user is the GM configured for the server, or
+// the "channel" rule allows them to do action.
+func (bot *Bot) checkGM(context MessageContext, action string) error {
+	if gm := bot.Setting(context, "gm"); gm != "none" && gm == context.UserId {
+		return nil
+	}
+	return bot.checkRule(context, "channel", action)
+}
+
+// checkPermission returns a PermissionError if the user is not allowed to change variables in
+// the given scope.
+func (bot *Bot) checkPermission(context MessageContext, scope string) error {
+	scopeType := strings.SplitN(scope, "-", 2)[0]
+	return bot.checkRule(context, scopeType, fmt.Sprintf("change %s variables", scopeType))
+}
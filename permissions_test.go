@@ -0,0 +1,78 @@
+package dicebot
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPermissionRule_Allows(t *testing.T) {
+	tests := []struct {
+		rule        PermissionRule
+		permissions int64
+		roles       []string
+		allowed     bool
+	}{
+		{PermissionRule{}, 0, nil, true},
+		{PermissionRule{Permissions: PermissionManageGuild}, 0, nil, false},
+		{PermissionRule{Permissions: PermissionManageGuild}, PermissionManageGuild, nil, true},
+		{PermissionRule{Permissions: PermissionAdministrator | PermissionManageGuild}, PermissionAdministrator, nil, true},
+		{PermissionRule{Roles: []string{"GM"}}, 0, []string{"Player"}, false},
+		{PermissionRule{Roles: []string{"GM"}}, 0, []string{"Player", "gm"}, true},
+		{PermissionRule{Permissions: PermissionManageGuild, Roles: []string{"GM"}}, PermissionManageChannels, []string{"GM"}, true},
+	}
+
+	for _, test := range tests {
+		context := MessageContext{Permissions: test.permissions, Roles: test.roles}
+		if allowed := test.rule.Allows(context); allowed != test.allowed {
+			t.Errorf("%+v.Allows(%v, %v) got %v expected %v", test.rule, test.permissions, test.roles, allowed, test.allowed)
+		}
+	}
+}
+
+func TestPermissions_AddRole(t *testing.T) {
+	permissions := DefaultPermissions()
+	permissions.AddRole("GM", "channel", "server")
+
+	context := MessageContext{Roles: []string{"GM"}}
+	for _, scopeType := range []string{"channel", "server"} {
+		if !permissions[scopeType].Allows(context) {
+			t.Errorf("AddRole() should allow GM to change %s variables", scopeType)
+		}
+	}
+	if permissions["config"].Allows(context) {
+		t.Errorf("AddRole() should not allow GM to change the configuration")
+	}
+}
+
+func ExampleBot_Save_permissions() {
+	bot := &Bot{db: &JsonDatabase{}, permissions: DefaultPermissions()}
+
+	fmt.Println(bot.HandleMessage(context, "!save 1 as x"))
+	fmt.Println(bot.HandleMessage(context, "!save 1 as x for channel"))
+	fmt.Println(bot.HandleMessage(context, "!save 1 as x for server"))
+
+	gm := context
+	gm.Permissions = PermissionManageGuild
+	fmt.Println(bot.HandleMessage(gm, "!save 1 as x for server"))
+	fmt.Println(bot.HandleMessage(context, "!undo x for server"))
+	// Output:
+	// Saved **1** as `x`
+	// Sorry, you don't have permission to change channel variables
+	// Sorry, you don't have permission to change server variables
+	// Saved **1** as `x`
+	// Sorry, you don't have permission to change server variables
+}
+
+func ExampleBot_EndSession_permissions() {
+	bot := &Bot{db: &JsonDatabase{}, permissions: DefaultPermissions()}
+	gm := context
+	gm.Permissions = PermissionManageChannels
+
+	fmt.Println(bot.HandleMessage(gm, "!save 1 as x for channel until session end"))
+	fmt.Println(bot.HandleMessage(context, "!session end"))
+	fmt.Println(bot.HandleMessage(gm, "!session end"))
+	// Output:
+	// Saved **1** as `x` until session end
+	// Sorry, you don't have permission to end the session
+	// Session ended, removed 1 temporary expression.
+}
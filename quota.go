@@ -0,0 +1,86 @@
+package dicebot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Limits restricts what users can save. A limit of zero means unlimited.
+type Limits struct {
+	// Variables maps a scope type ("user", "channel" or "server") to the maximum number of
+	// variables that can be saved in a single scope of that type. The "moves" and "tables"
+	// limits are the number of move and table files that can be uploaded for a server.
+	Variables        map[string]int
+	ExpressionLength int
+	ExpressionSize   int
+}
+
+type LimitError struct {
+	Message string
+}
+
+func (e LimitError) Error() string {
+	return e.Message
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		Variables: map[string]int{
+			"user":    50,
+			"channel": 50,
+			"server":  100,
+			"moves":   10,
+			"tables":  10,
+		},
+		ExpressionLength: 200,
+		ExpressionSize:   100,
+	}
+}
+
+func (bot *Bot) checkLength(input string) error {
+	if bot.limits.ExpressionLength > 0 && len(input) > bot.limits.ExpressionLength {
+		return LimitError{fmt.Sprintf("expressions can't be longer than %d characters", bot.limits.ExpressionLength)}
+	}
+	return nil
+}
+
+func (bot *Bot) checkSize(expr Expr) error {
+	if bot.limits.ExpressionSize > 0 && Size(expr) > bot.limits.ExpressionSize {
+		return LimitError{"expression is too complex to save"}
+	}
+	return nil
+}
+
+// checkQuota returns a LimitError if a new variable can not be added to the given scope.
+func (bot *Bot) checkQuota(name, scope string) error {
+	if _, found := bot.db.ReadValue(name, scope); found {
+		return nil
+	}
+
+	scopeType := strings.SplitN(scope, "-", 2)[0]
+	max := bot.limits.Variables[scopeType]
+	if max > 0 && len(bot.db.ListValues(scope)) >= max {
+		return LimitError{fmt.Sprintf("you can't save more than %d %s variables", max, scopeType)}
+	}
+	return nil
+}
+
+func (bot *Bot) Quota(context MessageContext) string {
+	s := "Saved expressions:\n"
+	for _, scope := range []struct{ for_, description string }{
+		{"user", "for you"},
+		{"channel", "for this channel"},
+		{"server", "for this server"},
+	} {
+		name, _ := context.scope(scope.for_)
+		s += fmt.Sprintf(" * %s: %d", scope.description, len(bot.db.ListValues(name)))
+		if max := bot.limits.Variables[scope.for_]; max > 0 {
+			s += fmt.Sprintf(" of %d", max)
+		}
+		s += "\n"
+	}
+	if bot.limits.ExpressionLength > 0 {
+		s += fmt.Sprintf("Saved expressions can be up to %d characters long.\n", bot.limits.ExpressionLength)
+	}
+	return s
+}
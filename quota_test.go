@@ -0,0 +1,45 @@
+package dicebot
+
+import "fmt"
+
+func ExampleBot_Save_limits() {
+	bot := &Bot{
+		db: &JsonDatabase{},
+		limits: Limits{
+			Variables:        map[string]int{"user": 2},
+			ExpressionLength: 10,
+			ExpressionSize:   5,
+		},
+	}
+
+	fmt.Println(bot.HandleMessage(context, "!save 1 as a"))
+	fmt.Println(bot.HandleMessage(context, "!save 2 as b"))
+	fmt.Println(bot.HandleMessage(context, "!save 3 as c"))
+	fmt.Println(bot.HandleMessage(context, "!save 3 as b"))
+	fmt.Println(bot.HandleMessage(context, "!save 10+20+30+40 as b"))
+	fmt.Println(bot.HandleMessage(context, "!save 1+2+3+4 as b"))
+	fmt.Println(bot.HandleMessage(context, "!save 1 as c for channel"))
+	// Output:
+	// Saved **1** as `a`
+	// Saved **2** as `b`
+	// Sorry, you can't save more than 2 user variables
+	// Saved **3** as `b`
+	// Sorry, expressions can't be longer than 10 characters
+	// Sorry, expression is too complex to save
+	// Saved **1** as `c`
+}
+
+func ExampleBot_Quota() {
+	bot := &Bot{db: &JsonDatabase{}, limits: DefaultLimits()}
+	bot.Save(context, "1", "a", "user")
+	bot.Save(context, "2", "b", "user")
+	bot.Save(context, "3", "c", "server")
+
+	fmt.Print(bot.HandleMessage(context, "!quota"))
+	// Output:
+	// Saved expressions:
+	//  * for you: 2 of 50
+	//  * for this channel: 0 of 50
+	//  * for this server: 1 of 100
+	// Saved expressions can be up to 200 characters long.
+}
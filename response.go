@@ -0,0 +1,175 @@
+package dicebot
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxResponseLength is the longest response that fits in a single message.
+const MaxResponseLength = 2000
+
+// AbbreviatedRolls is the number of rolls shown of each list of rolls in an abbreviated
+// explanation.
+const AbbreviatedRolls = 10
+
+type Visibility int
+
+const (
+	// Public responses are sent to the channel the command was given in.
+	Public Visibility = iota
+	// Private responses are only sent to their recipients, as a direct message or a reply
+	// only the recipient can see.
+	Private
+)
+
+// Limits of embeds. Discord refuses a message with an embed that exceeds any of them.
+const (
+	MaxTitleLength       = 256
+	MaxDescriptionLength = 4096
+	MaxFieldNameLength   = 256
+	MaxFieldLength       = 1024
+	MaxFields            = 25
+	MaxEmbedLength       = 6000
+)
+
+type EmbedField struct {
+	Name   string
+	Value  string
+	Inline bool
+}
+
+// Embed is a block of formatted text with a title and fields, for frontends that can show it.
+type Embed struct {
+	Title       string
+	Description string
+	Fields      []EmbedField
+}
+
+// length returns the number of characters in an embed, as Discord counts them.
+func (embed *Embed) length() int {
+	n := utf8.RuneCountInString(embed.Title) + utf8.RuneCountInString(embed.Description)
+	for _, field := range embed.Fields {
+		n += utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	}
+	return n
+}
+
+// setDescription sets the description of an embed, shortened to MaxDescriptionLength.
+func (embed *Embed) setDescription(description string) {
+	embed.Description = truncate(description, MaxDescriptionLength)
+}
+
+// addField adds a field to an embed, shortened to MaxFieldLength. It returns false if the
+// embed already has MaxFields fields, or the field would make it longer than MaxEmbedLength.
+func (embed *Embed) addField(name, value string, inline bool) bool {
+	field := EmbedField{Name: truncate(name, MaxFieldNameLength), Value: truncate(value, MaxFieldLength), Inline: inline}
+	length := embed.length() + utf8.RuneCountInString(field.Name) + utf8.RuneCountInString(field.Value)
+	if len(embed.Fields) >= MaxFields || length > MaxEmbedLength {
+		return false
+	}
+	embed.Fields = append(embed.Fields, field)
+	return true
+}
+
+// truncate shortens s to at most max runes, ending with an ellipsis if anything was cut off.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return strings.TrimRight(string(runes[:max-1]), " \n") + "…"
+}
+
+// Attachment is a file sent along with a response.
+type Attachment struct {
+	Name    string
+	Content string
+}
+
+// Button is a button shown below a response. Pressing it runs the action with HandleButton.
+type Button struct {
+	Label  string
+	Action string
+}
+
+// Response is a message the bot sends in response to a command.
+type Response struct {
+	Content    string
+	Embed      *Embed
+	Visibility Visibility
+	// Recipients are the IDs of the users that receive a private response.
+	Recipients []string
+	// RecipientRoles are the names of roles whose members receive a private response.
+	RecipientRoles []string
+	// ReplyTo is the ID of the message this is a reply to, if any.
+	ReplyTo     string
+	Attachments []Attachment
+	Buttons     []Button
+}
+
+type Responses []Response
+
+// reply creates a public response, or no response if the content is empty.
+func reply(content string) Responses {
+	if content == "" {
+		return nil
+	}
+	return Responses{{Content: content}}
+}
+
+// String returns the response as plain text, for frontends that can't show embeds.
+func (response Response) String() string {
+	var lines []string
+	if response.Content != "" {
+		lines = append(lines, response.Content)
+	}
+	if embed := response.Embed; embed != nil {
+		if embed.Title != "" {
+			lines = append(lines, embed.Title)
+		}
+		if embed.Description != "" {
+			lines = append(lines, embed.Description)
+		}
+		for _, field := range embed.Fields {
+			lines = append(lines, field.Value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// String returns all public responses as plain text.
+func (responses Responses) String() string {
+	var contents []string
+	for _, response := range responses {
+		if response.Visibility == Public {
+			contents = append(contents, response.String())
+		}
+	}
+	return strings.Join(contents, "\n")
+}
+
+// SplitContent splits content into pages of at most max bytes, at line boundaries where
+// possible.
+func SplitContent(content string, max int) []string {
+	var pages []string
+	page := ""
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if len(page)+len(line) > max && page != "" {
+			pages = append(pages, strings.TrimRight(page, "\n"))
+			page = ""
+		}
+		for len(line) > max {
+			i := max
+			for i > 0 && !utf8.RuneStart(line[i]) {
+				i -= 1
+			}
+			pages = append(pages, line[:i])
+			line = line[i:]
+		}
+		page += line
+	}
+	if strings.TrimSpace(page) != "" || len(pages) == 0 {
+		pages = append(pages, strings.TrimRight(page, "\n"))
+	}
+	return pages
+}
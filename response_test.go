@@ -0,0 +1,76 @@
+package dicebot
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func ExampleResponses_String() {
+	responses := Responses{
+		{Content: "Player made a secret roll."},
+		{Content: "d20 => **20**", Visibility: Private, Recipients: []string{"user"}},
+		{Content: "Good luck!"},
+	}
+	fmt.Println(responses)
+	fmt.Printf("%q\n", reply(""))
+	// Output:
+	// Player made a secret roll.
+	// Good luck!
+	// ""
+}
+
+func ExampleResponse_String() {
+	response := Response{
+		Content: "Player makes a move",
+		Embed: &Embed{
+			Title:       "Move",
+			Description: "When you do a thing, roll+Str.",
+			Fields:      []EmbedField{{Name: "Roll", Value: "2d6+Str => **11**"}},
+		},
+	}
+	fmt.Println(response)
+	// Output:
+	// Player makes a move
+	// Move
+	// When you do a thing, roll+Str.
+	// 2d6+Str => **11**
+}
+
+func TestSplitContent(t *testing.T) {
+	tests := []struct {
+		content string
+		max     int
+		pages   []string
+	}{
+		{"", 10, []string{""}},
+		{"short", 10, []string{"short"}},
+		{"one\ntwo\nthree", 8, []string{"one\ntwo", "three"}},
+		{"a very long line", 5, []string{"a ver", "y lon", "g lin", "e"}},
+		{"ééé", 3, []string{"é", "é", "é"}},
+	}
+
+	for _, test := range tests {
+		pages := SplitContent(test.content, test.max)
+		if !reflect.DeepEqual(pages, test.pages) {
+			t.Errorf("SplitContent(%q, %d): expected %q, got %q", test.content, test.max, test.pages, pages)
+		}
+	}
+}
+
+func ExampleEmbed_addField() {
+	embed := &Embed{Title: "Title"}
+	fmt.Println(embed.addField("Short", "value", false))
+	fmt.Println(embed.addField("Long", strings.Repeat("é", 2000), false))
+	fmt.Println(len([]rune(embed.Fields[1].Value)), strings.HasSuffix(embed.Fields[1].Value, "…"))
+	for len(embed.Fields) < MaxFields {
+		embed.Fields = append(embed.Fields, EmbedField{Name: "x", Value: "y"})
+	}
+	fmt.Println(embed.addField("Too many", "value", false))
+	// Output:
+	// true
+	// true
+	// 1024 true
+	// false
+}
@@ -0,0 +1,158 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultRollHistory is the number of rolls `!history` shows by default.
+const DefaultRollHistory = 10
+
+func (context MessageContext) rollScope() string {
+	return "channel-" + context.ChannelId
+}
+
+// roll evaluates an expression like Eval, and adds the result to the roll log of the channel.
+func (bot *Bot) roll(context MessageContext, input string) (value int, explanation string, err error) {
+	value, explanation, err = bot.Eval(context, input)
+	if err == nil {
+		bot.logRoll(context, input, value, explanation)
+	}
+	return
+}
+
+// rollWithBonuses evaluates an expression with the bonuses of a user added to it, like roll.
+// The roll is logged without the bonuses, so a reroll doesn't add a used forward bonus again.
+func (bot *Bot) rollWithBonuses(context MessageContext, input, withBonuses string) (value int, explanation string, err error) {
+	value, explanation, err = bot.Eval(context, withBonuses)
+	if err == nil {
+		bot.logRoll(context, input, value, explanation)
+	}
+	return
+}
+
+// logRoll adds a roll to the roll log of the channel. Failing to log a roll should not keep
+// the user from seeing the result, so errors are ignored.
+func (bot *Bot) logRoll(context MessageContext, input string, value int, explanation string) {
+	bot.db.LogRoll(context.rollScope(), LoggedRoll{
+		UserId:      context.UserId,
+		UserName:    context.UserName,
+		ChannelId:   context.ChannelId,
+		ServerId:    context.ServerId,
+		Input:       input,
+		Explanation: explanation,
+		Result:      value,
+		Time:        time.Now(),
+	})
+}
+
+// lastRoll returns the last roll a user made in a channel.
+func (bot *Bot) lastRoll(context MessageContext) (LoggedRoll, bool) {
+	rolls := bot.db.ReadRolls(context.rollScope())
+	for i := len(rolls) - 1; i >= 0; i -= 1 {
+		if rolls[i].UserId == context.UserId {
+			return rolls[i], true
+		}
+	}
+	return LoggedRoll{}, false
+}
+
+func (bot *Bot) formatLoggedRoll(roll LoggedRoll) string {
+	explanation := AbbreviateExplanation(roll.Explanation, AbbreviatedRolls)
+	s := EscapeMarkdown(roll.UserName) + ": " + bot.FormatResult(roll.Input, roll.Result, explanation)
+	if !roll.Time.IsZero() {
+		s += " on " + roll.Time.UTC().Format("2006-01-02 15:04")
+	}
+	return s
+}
+
+func (bot *Bot) LastRoll(context MessageContext) string {
+	roll, found := bot.lastRoll(context)
+	if !found {
+		return bot.HandleError("last", errors.New("you haven't rolled anything in this channel yet"))
+	}
+	return bot.formatLoggedRoll(roll)
+}
+
+// RollHistory shows the last count rolls made in a channel, by any user.
+func (bot *Bot) RollHistory(context MessageContext, count int) string {
+	rolls := bot.db.ReadRolls(context.rollScope())
+	if len(rolls) == 0 {
+		return "Nobody has rolled anything in this channel yet."
+	}
+	if count < len(rolls) {
+		rolls = rolls[len(rolls)-count:]
+	}
+
+	s := "Last rolls in this channel:\n"
+	for _, roll := range rolls {
+		s += " * " + bot.formatLoggedRoll(roll) + "\n"
+	}
+	return s
+}
+
+// Reroll evaluates the last expression a user rolled in a channel again. Every expression of a
+// roll like `d20; 2d6` is logged on its own, so only the last one is rolled again.
+func (bot *Bot) Reroll(context MessageContext) Response {
+	roll, found := bot.lastRoll(context)
+	if !found {
+		return Response{Content: bot.HandleError("reroll", errors.New("you haven't rolled anything in this channel yet"))}
+	}
+	return bot.RollDice(context, roll.Input)
+}
+
+func lastHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	return reply(bot.LastRoll(context))
+}
+
+func rerollHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	return Responses{bot.Reroll(context)}
+}
+
+func historyHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	if args["name"] != "" {
+		response, err := bot.History(context, args["name"], args["for"])
+		if err != nil {
+			return reply(bot.HandleError(withScope("history "+args["name"], args["for"]), err))
+		}
+		return reply(response)
+	}
+
+	count := DefaultRollHistory
+	if args["count"] != "" {
+		var err error
+		count, err = strconv.Atoi(args["count"])
+		if err != nil || count <= 0 || count > MaxRolls {
+			return reply(bot.HandleError("history "+args["count"], errors.New(fmt.Sprintf("you can see up to %d rolls", MaxRolls))))
+		}
+	}
+	return reply(bot.RollHistory(context, count))
+}
+
+// SecretRoll rolls dice like RollDice, but only sends the result to the roller and the GM
+// configured for the server. The channel only sees that a roll was made. Secret rolls are
+// not logged, so they can't be seen with `!history`.
+func (bot *Bot) SecretRoll(context MessageContext, input string) Responses {
+	results := bot.rollExpressions(context, input, bot.Eval)
+
+	private := bot.resultResponse("Secret roll by "+EscapeMarkdown(context.UserName)+":\n", results)
+	private.Visibility = Private
+	private.Recipients = []string{context.UserId}
+	if gm := bot.Setting(context, "gm"); gm != "none" && gm != context.UserId {
+		private.Recipients = append(private.Recipients, gm)
+	}
+	if role := bot.Setting(context, "gm-role"); role != "none" {
+		private.RecipientRoles = append(private.RecipientRoles, role)
+	}
+
+	return Responses{
+		{Content: EscapeMarkdown(context.UserName) + " made a secret roll."},
+		private,
+	}
+}
+
+func secretHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	return bot.SecretRoll(context, args["dice"])
+}
@@ -0,0 +1,104 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+)
+
+func ExampleBot_HandleMessage_rollHistory() {
+	bot := &Bot{db: &JsonDatabase{}}
+	for i, user := range []MessageContext{context, {UserId: "other", UserName: "Other"}, context} {
+		bot.db.LogRoll("channel-channel", LoggedRoll{
+			UserId:      user.UserId,
+			UserName:    user.UserName,
+			Input:       "2d6",
+			Explanation: fmt.Sprintf("(%d + 1)", i+1),
+			Result:      i + 2,
+			Time:        time.Date(2020, 1, 2, 3, 4+i, 0, 0, time.UTC),
+		})
+	}
+
+	fmt.Print(bot.HandleMessage(context, "!history"))
+	fmt.Print(bot.HandleMessage(context, "!history 2"))
+	fmt.Println(bot.HandleMessage(context, "!history 0"))
+	fmt.Println(bot.HandleMessage(context, "!last"))
+	// Output:
+	// Last rolls in this channel:
+	//  * Player: 2d6 => **(1 + 1)** => **2** on 2020-01-02 03:04
+	//  * Other: 2d6 => **(2 + 1)** => **3** on 2020-01-02 03:05
+	//  * Player: 2d6 => **(3 + 1)** => **4** on 2020-01-02 03:06
+	// Last rolls in this channel:
+	//  * Other: 2d6 => **(2 + 1)** => **3** on 2020-01-02 03:05
+	//  * Player: 2d6 => **(3 + 1)** => **4** on 2020-01-02 03:06
+	// Sorry, I don't understand how to parse 'history 0': you can see up to 100 rolls
+	// Player: 2d6 => **(3 + 1)** => **4** on 2020-01-02 03:06
+}
+
+func ExampleBot_HandleMessage_reroll() {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}}
+
+	fmt.Println(bot.HandleMessage(context, "!reroll"))
+	fmt.Println(bot.HandleMessage(context, "!roll d20; 2d6"))
+	fmt.Println(bot.HandleMessage(context, "!reroll"))
+	// Output:
+	// Sorry, I don't understand how to parse 'reroll': you haven't rolled anything in this channel yet
+	// d20 => **2**
+	// 2d6 => **(4 + 6)** => **10**
+	// 2d6 => **(6 + 2)** => **8**
+}
+
+func TestBot_LastRoll(t *testing.T) {
+	bot := &Bot{db: &JsonDatabase{}}
+	bot.HandleMessage(context, "!roll 5")
+	bot.HandleMessage(context, "I attack [[1 + 2]]")
+
+	otherUser := context
+	otherUser.UserId = "other"
+	bot.HandleMessage(otherUser, "!roll 7")
+
+	if got := bot.LastRoll(context); !strings.HasPrefix(got, "Player: 1 + 2 => **3** on ") {
+		t.Errorf("LastRoll() got %v", got)
+	}
+	if rolls := bot.db.ReadRolls("channel-channel"); len(rolls) != 3 {
+		t.Errorf("ReadRolls() got %+v", rolls)
+	}
+}
+
+func ExampleBot_SecretRoll() {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}}
+	admin := context
+	admin.UserId = "1234"
+
+	bot.HandleMessage(admin, "!config gm me")
+	bot.HandleMessage(admin, "!config gm-role Referee")
+	for _, response := range bot.HandleMessage(context, "!groll d20+2") {
+		fmt.Println(response.Visibility, response.Recipients, response.RecipientRoles)
+		fmt.Println(response.Content)
+	}
+	fmt.Printf("%q\n", bot.HandleMessage(context, "!history"))
+	// Output:
+	// 0 [] []
+	// Player made a secret roll.
+	// 1 [user 1234] [Referee]
+	// Secret roll by Player:
+	// d20+2 => **2 + 2** => **4**
+	// "Nobody has rolled anything in this channel yet."
+}
+
+func ExampleBot_HandleCommand_secret() {
+	rand.Seed(1)
+	bot := &Bot{db: &JsonDatabase{}}
+
+	responses := bot.HandleCommand(context, "roll", map[string]string{"dice": "d6", "secret": "true"})
+	fmt.Println(responses)
+	fmt.Println(responses[1].Recipients, responses[1].Content)
+	// Output:
+	// Player made a secret roll.
+	// [user] Secret roll by Player:
+	// d6 => **6**
+}
@@ -0,0 +1,321 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const holdPrefix = "hold:"
+
+// MaxStateValue is the largest hold, forward or ongoing bonus a user can have, in either
+// direction.
+const MaxStateValue = 100
+
+// stateScope is the scope of the hold, forward and ongoing bonuses of a user on a server.
+func (context MessageContext) stateScope() string {
+	return "state-user-" + context.UserId + "-server-" + context.ServerId
+}
+
+// readStateValue reads a hold, forward or ongoing bonus of a user.
+func (bot *Bot) readStateValue(context MessageContext, name string) (int, error) {
+	value, found := bot.db.ReadValue(name, context.stateScope())
+	if !found {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid value `%s` for %s", value, name))
+	}
+	return n, nil
+}
+
+// stateValue is like readStateValue, for showing and using the value. Invalid values count
+// as 0, and are replaced the next time the value changes.
+func (bot *Bot) stateValue(context MessageContext, name string) int {
+	n, _ := bot.readStateValue(context, name)
+	return n
+}
+
+func (bot *Bot) setStateValue(context MessageContext, name string, value int) error {
+	if value == 0 {
+		return bot.db.DeleteValue(name, context.stateScope())
+	}
+	return bot.db.StoreValue(name, context.stateScope(), strconv.Itoa(value))
+}
+
+func (bot *Bot) addStateValue(context MessageContext, name string, value int) error {
+	current, _ := bot.readStateValue(context, name)
+	total := current + value
+	if total > MaxStateValue || total < -MaxStateValue {
+		return errors.New(fmt.Sprintf("the total can't be more than %d", MaxStateValue))
+	}
+	return bot.setStateValue(context, name, total)
+}
+
+// parseStateValue parses the amount of hold or bonus in a command.
+func parseStateValue(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n == 0 || n > MaxStateValue || n < -MaxStateValue {
+		return 0, errors.New(fmt.Sprintf("the value must be between -%d and %d, and not 0", MaxStateValue, MaxStateValue))
+	}
+	return n, nil
+}
+
+// holdName returns the name of the move hold was gained for, or an empty string for hold that
+// is not for a specific move.
+func (bot *Bot) holdName(key string) string {
+	bot.movesMutex.RLock()
+	defer bot.movesMutex.RUnlock()
+
+	for _, move := range bot.moves {
+		if strings.ToLower(move.Name) == key {
+			return move.Name
+		}
+	}
+	return key
+}
+
+// withBonuses adds the pending forward bonus of a user to a roll, and the ongoing bonus if
+// ongoing is true. It returns the roll and a description of the bonuses.
+func (bot *Bot) withBonuses(context MessageContext, roll string, ongoing bool) (string, string) {
+	var bonuses []string
+	if forward := bot.stateValue(context, "forward"); forward != 0 {
+		roll += fmt.Sprintf(" %+d", forward)
+		bonuses = append(bonuses, fmt.Sprintf("%+d forward", forward))
+	}
+	if ongoing {
+		if bonus := bot.stateValue(context, "ongoing"); bonus != 0 {
+			roll += fmt.Sprintf(" %+d", bonus)
+			bonuses = append(bonuses, fmt.Sprintf("%+d ongoing", bonus))
+		}
+	}
+	return roll, strings.Join(bonuses, ", ")
+}
+
+// useForward removes the pending forward bonus of a user, after it was added to a roll.
+func (bot *Bot) useForward(context MessageContext) error {
+	return bot.setStateValue(context, "forward", 0)
+}
+
+// gain adds the hold and bonuses of an outcome of a move. It returns a description of what
+// was gained.
+func (bot *Bot) gain(context MessageContext, move Move, outcome Outcome) (string, error) {
+	var gained []string
+	if outcome.Hold != 0 {
+		if err := bot.addStateValue(context, holdPrefix+strings.ToLower(move.Name), outcome.Hold); err != nil {
+			return "", err
+		}
+		gained = append(gained, fmt.Sprintf("hold %d", outcome.Hold))
+	}
+	if outcome.Forward != 0 {
+		if err := bot.addStateValue(context, "forward", outcome.Forward); err != nil {
+			return "", err
+		}
+		gained = append(gained, fmt.Sprintf("%+d forward", outcome.Forward))
+	}
+	if outcome.Ongoing != 0 {
+		if err := bot.addStateValue(context, "ongoing", outcome.Ongoing); err != nil {
+			return "", err
+		}
+		gained = append(gained, fmt.Sprintf("%+d ongoing", outcome.Ongoing))
+	}
+	return strings.Join(gained, ", "), nil
+}
+
+// ShowState shows the hold, forward and ongoing bonuses of a user.
+func (bot *Bot) ShowState(context MessageContext) string {
+	var holds []string
+	for _, name := range bot.db.ListValues(context.stateScope()) {
+		if strings.HasPrefix(name, holdPrefix) {
+			holds = append(holds, name)
+		}
+	}
+	sort.Strings(holds)
+
+	forward, ongoing := bot.stateValue(context, "forward"), bot.stateValue(context, "ongoing")
+	if len(holds) == 0 && forward == 0 && ongoing == 0 {
+		return "You don't have any hold, forward or ongoing bonuses."
+	}
+
+	s := ""
+	for _, key := range holds {
+		if name := bot.holdName(key[len(holdPrefix):]); name != "" {
+			s += fmt.Sprintf("Hold for %s: %d\n", EscapeMarkdown(name), bot.stateValue(context, key))
+		} else {
+			s += fmt.Sprintf("Hold: %d\n", bot.stateValue(context, key))
+		}
+	}
+	if forward != 0 {
+		s += fmt.Sprintf("Forward: %+d\n", forward)
+	}
+	if ongoing != 0 {
+		s += fmt.Sprintf("Ongoing: %+d\n", ongoing)
+	}
+	return strings.TrimSuffix(s, "\n")
+}
+
+// findHold finds the hold for a move. If no move is given and a user only has hold for one
+// move, that hold is used.
+func (bot *Bot) findHold(context MessageContext, moveName string) (string, error) {
+	if moveName != "" {
+		key := holdPrefix + strings.ToLower(moveName)
+		if bot.stateValue(context, key) == 0 {
+			return "", errors.New(fmt.Sprintf("you don't have hold for %s", moveName))
+		}
+		return key, nil
+	}
+
+	var keys []string
+	for _, name := range bot.db.ListValues(context.stateScope()) {
+		if strings.HasPrefix(name, holdPrefix) {
+			keys = append(keys, name)
+		}
+	}
+	switch len(keys) {
+	case 0:
+		return "", errors.New("you don't have any hold")
+	case 1:
+		return keys[0], nil
+	default:
+		return "", errors.New("you have hold for several moves, say which one to spend")
+	}
+}
+
+// SpendHold spends hold a user gained for a move.
+func (bot *Bot) SpendHold(context MessageContext, count int, moveName string) (string, error) {
+	key, err := bot.findHold(context, moveName)
+	if err != nil {
+		return "", err
+	}
+
+	if count <= 0 {
+		return "", errors.New("you can only spend 1 hold or more")
+	}
+	hold, err := bot.readStateValue(context, key)
+	if err != nil {
+		return "", err
+	}
+	if count > hold {
+		return "", errors.New(fmt.Sprintf("you only have hold %d", hold))
+	}
+	if err := bot.setStateValue(context, key, hold-count); err != nil {
+		return "", err
+	}
+
+	s := fmt.Sprintf("Spent hold %d", count)
+	if name := bot.holdName(key[len(holdPrefix):]); name != "" {
+		s += " for " + EscapeMarkdown(name)
+	}
+	return s + fmt.Sprintf(", %d left.", hold-count), nil
+}
+
+// targetUser returns the context of the user mentioned in user, so the GM can change the state
+// of a player. Without a mention, it is the context of the user who sent the message.
+func targetUser(context MessageContext, user string) (MessageContext, error) {
+	if user == "" {
+		return context, nil
+	}
+	id, err := parseUser(context, user)
+	if err != nil || id == "none" {
+		return context, errors.New("the user must be a mention or a user ID")
+	}
+	if id == context.UserId {
+		return context, nil
+	}
+
+	target := context
+	target.UserId, target.UserName = id, ""
+	if _, mentioned := context.Mentions[user]; mentioned {
+		target.UserName = strings.TrimPrefix(user, "@")
+	}
+	return target, nil
+}
+
+// addressed addresses a reply to the target of a command, if that is somebody else.
+func addressed(context, target MessageContext, s string) string {
+	if target.UserId == context.UserId {
+		return s
+	}
+	return "<@" + target.UserId + "> " + s
+}
+
+func holdHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	text := strings.TrimSpace(strings.Join([]string{"hold", args["action"], args["count"], args["move"], args["user"]}, " "))
+	count := 1
+	if args["count"] != "" {
+		var err error
+		if count, err = strconv.Atoi(args["count"]); err != nil || count <= 0 || count > MaxStateValue {
+			return reply(bot.HandleError(text, errors.New(fmt.Sprintf("the hold must be between 1 and %d", MaxStateValue))))
+		}
+	}
+	target, err := targetUser(context, args["user"])
+	if err != nil {
+		return reply(bot.HandleError(text, err))
+	}
+
+	switch args["action"] {
+	case "":
+		return reply(addressed(context, target, bot.ShowState(target)))
+	case "spend":
+		// Players spend their own hold, the GM can spend it for them.
+		if target.UserId != context.UserId {
+			if err := bot.checkGM(context, "spend hold for somebody else"); err != nil {
+				return reply(bot.HandleError(text, err))
+			}
+		}
+		response, err := bot.SpendHold(target, count, args["move"])
+		if err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		return reply(addressed(context, target, response))
+	default:
+		if err := bot.checkGM(context, "add hold"); err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		key := holdPrefix + strings.ToLower(args["move"])
+		if err := bot.addStateValue(target, key, count); err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		return reply(addressed(context, target, bot.ShowState(target)))
+	}
+}
+
+// bonusHandler returns a handler for the command that shows or changes the forward or ongoing
+// bonus. Anyone can take a penalty or clear their bonus, but only the GM can add a bonus or
+// change the bonus of somebody else.
+func bonusHandler(name string) Handler {
+	return func(bot *Bot, context MessageContext, args map[string]string) Responses {
+		text := strings.TrimSpace(name + " " + args["bonus"] + " " + args["user"])
+		target, err := targetUser(context, args["user"])
+		if err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		if target.UserId != context.UserId && args["bonus"] != "" {
+			if err := bot.checkGM(context, "change the bonus of somebody else"); err != nil {
+				return reply(bot.HandleError(text, err))
+			}
+		}
+
+		switch bonus := args["bonus"]; bonus {
+		case "":
+			return reply(addressed(context, target, bot.ShowState(target)))
+		case "clear":
+			err = bot.setStateValue(target, name, 0)
+		default:
+			var n int
+			if n, err = parseStateValue(bonus); err == nil && n > 0 {
+				err = bot.checkGM(context, "add a bonus")
+			}
+			if err == nil {
+				err = bot.addStateValue(target, name, n)
+			}
+		}
+		if err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		return reply(addressed(context, target, bot.ShowState(target)))
+	}
+}
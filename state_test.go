@@ -0,0 +1,157 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+func ExampleBot_ShowState() {
+	rand.Seed(1)
+	bot := &Bot{
+		db: &JsonDatabase{},
+		moves: map[string]Move{
+			"discern realities": {
+				Name: "Discern Realities",
+				Roll: "2d6",
+				Outcomes: []Outcome{
+					{Range: "10+", Text: "Ask 3 questions.", Hold: 3},
+					{Range: "7-9", Text: "Ask 1 question.", Hold: 1},
+					{Range: "6-", Text: "Uh oh."},
+				},
+			},
+			"aid": {
+				Name:     "Aid",
+				Roll:     "2d6",
+				Outcomes: []Outcome{{Range: "7+", Text: "They take +1 forward.", Forward: 1}},
+			},
+		},
+	}
+
+	fmt.Println(bot.HandleMessage(context, "!hold"))
+	fmt.Println(bot.HandleMessage(context, "!move discern realities"))
+	fmt.Println(bot.HandleMessage(context, "!move aid"))
+	fmt.Println(bot.HandleMessage(context, "!ongoing +1"))
+	fmt.Println(bot.HandleMessage(context, "!hold spend 2"))
+	fmt.Println(bot.HandleMessage(context, "!hold spend 2"))
+	fmt.Println(bot.HandleMessage(context, "!move discern realities"))
+	fmt.Println(bot.HandleMessage(context, "!roll d20"))
+	fmt.Println(bot.HandleMessage(context, "!forward -1"))
+	fmt.Println(bot.HandleMessage(context, "!roll d20"))
+	fmt.Println(bot.HandleMessage(context, "!ongoing clear"))
+	// Output:
+	// You don't have any hold, forward or ongoing bonuses.
+	// Player makes a move: Discern Realities!
+	// 2d6 => **(6 + 4)** => **10**
+	// Ask 3 questions.
+	// You gain hold 3.
+	// Player makes a move: Aid!
+	// 2d6 => **(6 + 6)** => **12**
+	// They take +1 forward.
+	// You gain +1 forward.
+	// Hold for Discern Realities: 3
+	// Forward: +1
+	// Ongoing: +1
+	// Spent hold 2 for Discern Realities, 1 left.
+	// Sorry, I don't understand how to parse 'hold spend 2': you only have hold 1
+	// Player makes a move: Discern Realities!
+	// 2d6 +1 +1 => **(2 + 1) + 1 + 1** => **5**
+	// Including +1 forward, +1 ongoing.
+	// Uh oh. Mark XP.
+	// You have 1 XP.
+	// d20 => **6**
+	// Hold for Discern Realities: 1
+	// Forward: -1
+	// Ongoing: +1
+	// Including -1 forward:
+	// d20 -1 => **1 - 1** => **0**
+	// Hold for Discern Realities: 1
+}
+
+func ExampleBot_HandleMessage_stateLimits() {
+	bot := &Bot{db: &JsonDatabase{}, permissions: DefaultPermissions()}
+	gm := context
+	gm.Permissions = PermissionManageChannels
+
+	fmt.Println(bot.HandleMessage(context, "!forward +1"))
+	fmt.Println(bot.HandleMessage(context, "!hold add 3"))
+	fmt.Println(bot.HandleMessage(context, "!forward -1"))
+	fmt.Println(bot.HandleMessage(gm, "!forward 99999999999999999999"))
+	fmt.Println(bot.HandleMessage(gm, "!ongoing 0"))
+	fmt.Println(bot.HandleMessage(gm, "!ongoing +100"))
+	fmt.Println(bot.HandleMessage(gm, "!ongoing +1"))
+	fmt.Println(bot.HandleMessage(gm, "!hold add 2"))
+	fmt.Println(bot.HandleMessage(context, "!hold spend 0"))
+
+	bot.db.StoreValue("gm", "config-server-server", "user")
+	fmt.Println(bot.HandleMessage(context, "!forward clear"))
+	fmt.Println(bot.HandleMessage(context, "!forward +2"))
+	// Output:
+	// Sorry, you don't have permission to add a bonus
+	// Sorry, you don't have permission to add hold
+	// Forward: -1
+	// Sorry, I don't understand how to parse 'forward 99999999999999999999': the value must be between -100 and 100, and not 0
+	// Sorry, I don't understand how to parse 'ongoing 0': the value must be between -100 and 100, and not 0
+	// Forward: -1
+	// Ongoing: +100
+	// Sorry, I don't understand how to parse 'ongoing +1': the total can't be more than 100
+	// Hold: 2
+	// Forward: -1
+	// Ongoing: +100
+	// Sorry, I don't understand how to parse 'hold spend 0': the hold must be between 1 and 100
+	// Hold: 2
+	// Ongoing: +100
+	// Hold: 2
+	// Forward: +2
+	// Ongoing: +100
+}
+
+func ExampleBot_HandleMessage_stateTarget() {
+	bot := &Bot{db: &JsonDatabase{}, permissions: DefaultPermissions()}
+	gm := context
+	gm.UserId, gm.UserName, gm.Permissions = "gm", "GM", PermissionManageChannels
+	gm.Mentions = map[string]string{"@Player": "user"}
+	player := context
+	player.Mentions = map[string]string{"@GM": "gm"}
+
+	fmt.Println(bot.HandleMessage(gm, "!hold add 3 Defend @Player"))
+	fmt.Println(bot.HandleMessage(gm, "!forward +1 @Player"))
+	fmt.Println(bot.HandleMessage(gm, "!ongoing +1 @Player"))
+	fmt.Println(bot.HandleMessage(gm, "!hold"))
+	fmt.Println(bot.HandleMessage(player, "!hold"))
+	fmt.Println(bot.HandleMessage(player, "!forward -1 @GM"))
+	fmt.Println(bot.HandleMessage(player, "!hold spend 1 @GM"))
+	fmt.Println(bot.HandleMessage(player, "!hold spend 2 Defend"))
+	fmt.Println(bot.HandleMessage(gm, "!hold @Player"))
+	// Output:
+	// <@user> Hold for defend: 3
+	// <@user> Hold for defend: 3
+	// Forward: +1
+	// <@user> Hold for defend: 3
+	// Forward: +1
+	// Ongoing: +1
+	// You don't have any hold, forward or ongoing bonuses.
+	// Hold for defend: 3
+	// Forward: +1
+	// Ongoing: +1
+	// Sorry, you don't have permission to change the bonus of somebody else
+	// Sorry, you don't have permission to spend hold for somebody else
+	// Spent hold 2 for defend, 1 left.
+	// <@user> Hold for defend: 1
+	// Forward: +1
+	// Ongoing: +1
+}
+
+func ExampleBot_Reroll_forward() {
+	bot := &Bot{db: &JsonDatabase{}}
+
+	fmt.Println(bot.HandleMessage(context, "!forward +5"))
+	fmt.Println(bot.HandleMessage(context, "!roll 1"))
+	fmt.Println(bot.HandleMessage(context, "!reroll"))
+	fmt.Println(bot.HandleMessage(context, "!hold"))
+	// Output:
+	// Forward: +5
+	// Including +5 forward:
+	// 1 +5 => **1 + 5** => **6**
+	// 1 => **1**
+	// You don't have any hold, forward or ongoing bonuses.
+}
@@ -0,0 +1,416 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MaxTableDepth is how deep tables can roll on other tables, and MaxTableRolls is how many
+// nested tables can be rolled on for a single roll or move.
+const (
+	MaxTableDepth = 10
+	MaxTableRolls = 100
+)
+
+// TableEntry is an entry of a random table, selected when the roll is in Range, like "1-5" or
+// "96+". Entries without a range get a range as large as their Weight, which is 1 by default.
+// Text is a template: rolls like `[[d6]]` are rolled, and `{table:name}` rolls on another table.
+type TableEntry struct {
+	Range  string `json:"range,omitempty" yaml:"range,omitempty" toml:"range,omitempty"`
+	Weight int    `json:"weight,omitempty" yaml:"weight,omitempty" toml:"weight,omitempty"`
+	Text   string `json:"text" yaml:"text" toml:"text"`
+}
+
+// Table is a random table. If the entries have no ranges, Roll can be left out, and dice are
+// rolled for the total weight of the entries.
+type Table struct {
+	Name        string       `json:"name" yaml:"name" toml:"name"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty"`
+	Roll        string       `json:"roll,omitempty" yaml:"roll,omitempty" toml:"roll,omitempty"`
+	Entries     []TableEntry `json:"entries" yaml:"entries" toml:"entries"`
+	// Set is the name of the file the table was loaded from.
+	Set string `json:"-" yaml:"-" toml:"-"`
+}
+
+// tableFile is a file with tables. A file can also contain just a list of tables.
+type tableFile struct {
+	Tables []Table `json:"tables" yaml:"tables" toml:"tables"`
+}
+
+// tablesScope is the scope of the table files uploaded for a server, by filename.
+func (context MessageContext) tablesScope() string {
+	return "tables-server-" + context.ServerId
+}
+
+// LoadTables loads tables from a JSON, YAML or TOML file, depending on the extension of the
+// filename.
+func LoadTables(tables map[string]Table, filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	tableList, err := parseTables(filename, data)
+	if err != nil {
+		return err
+	}
+	for _, table := range tableList {
+		tables[table.key()] = table
+	}
+	return nil
+}
+
+// parseTables parses a table file. The format depends on the extension of the filename.
+func parseTables(filename string, data []byte) ([]Table, error) {
+	var file tableFile
+	if err := decodeFile(filename, data, &file.Tables, &file); err != nil {
+		return nil, errors.New(fmt.Sprintf("%s: %s", filename, err))
+	}
+
+	for i := range file.Tables {
+		table := &file.Tables[i]
+		table.Set = setName(filename)
+		if err := table.normalize(); err != nil {
+			return nil, errors.New(fmt.Sprintf("%s: table %s: %s", filename, table.Name, err))
+		}
+	}
+	return file.Tables, nil
+}
+
+// key returns the key of a table in a map of tables.
+func (table Table) key() string {
+	return table.Set + ":" + strings.ToLower(table.Name)
+}
+
+// normalize gives entries without a range a range for their weight, and checks the roll and
+// entries of a table.
+func (table *Table) normalize() error {
+	if table.Name == "" {
+		return errors.New("the table has no name")
+	}
+	if len(table.Entries) == 0 {
+		return errors.New("the table has no entries")
+	}
+
+	ranged := 0
+	for _, entry := range table.Entries {
+		if entry.Range != "" {
+			ranged++
+		}
+	}
+	if ranged != 0 && ranged != len(table.Entries) {
+		return errors.New("either all entries or none of them need a range")
+	}
+
+	total := 0
+	for i := range table.Entries {
+		entry := &table.Entries[i]
+		if entry.Range != "" {
+			continue
+		}
+		weight := entry.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		if weight == 1 {
+			entry.Range = fmt.Sprintf("%d", total+1)
+		} else {
+			entry.Range = fmt.Sprintf("%d-%d", total+1, total+weight)
+		}
+		total += weight
+	}
+
+	if table.Roll == "" {
+		if total == 0 {
+			return errors.New("the table has no roll")
+		}
+		table.Roll = fmt.Sprintf("d%d", total)
+	}
+	if _, err := ParseString(table.Roll); err != nil {
+		return errors.New(fmt.Sprintf("invalid roll `%s`: %s", table.Roll, err))
+	}
+
+	for _, entry := range table.Entries {
+		if _, _, err := parseRange(entry.Range); err != nil {
+			return err
+		}
+		for _, match := range inlineRoll.FindAllStringSubmatch(entry.Text, -1) {
+			if _, err := ParseString(match[1]); err != nil {
+				return errors.New(fmt.Sprintf("invalid roll `%s` in entry %s: %s", match[1], entry.Range, err))
+			}
+		}
+	}
+	return nil
+}
+
+// entry returns the entry of a table for a roll.
+func (table Table) entry(value int) (TableEntry, bool) {
+	for _, entry := range table.Entries {
+		min, max, err := parseRange(entry.Range)
+		if err == nil && value >= min && value <= max {
+			return entry, true
+		}
+	}
+	return TableEntry{}, false
+}
+
+// uploadedTables returns the tables uploaded for a server.
+func (bot *Bot) uploadedTables(context MessageContext) []Table {
+	var tables []Table
+	for _, file := range bot.uploaded(context, tableUploads) {
+		tables = append(tables, file.([]Table)...)
+	}
+	return tables
+}
+
+// allTables returns the tables uploaded for a server, followed by the tables that were loaded.
+func (bot *Bot) allTables(context MessageContext) []Table {
+	bot.tablesMutex.RLock()
+	loaded := make([]Table, 0, len(bot.tables))
+	for _, table := range bot.tables {
+		loaded = append(loaded, table)
+	}
+	bot.tablesMutex.RUnlock()
+
+	sort.Slice(loaded, func(i, j int) bool {
+		return loaded[i].key() < loaded[j].key()
+	})
+	return append(bot.uploadedTables(context), loaded...)
+}
+
+// findTable finds a table by name. Tables uploaded for a server take precedence over the
+// tables that were loaded.
+func (bot *Bot) findTable(context MessageContext, name string) (Table, bool) {
+	return findTable(bot.allTables(context), name)
+}
+
+func findTable(tables []Table, name string) (Table, bool) {
+	name = strings.TrimSpace(name)
+	for _, table := range tables {
+		if strings.EqualFold(table.Name, name) {
+			return table, true
+		}
+	}
+	return Table{}, false
+}
+
+// tableRolls keeps track of the nested tables rolled on for a single roll or move. The tables
+// are looked up once, when the first nested table is rolled.
+type tableRolls struct {
+	tables []Table
+	count  int
+}
+
+// find finds a nested table by name.
+func (rolls *tableRolls) find(bot *Bot, context MessageContext, name string) (Table, bool) {
+	if rolls.tables == nil {
+		rolls.tables = bot.allTables(context)
+	}
+	return findTable(rolls.tables, name)
+}
+
+// serverTables returns the tables for a server, sorted by name. Tables with the same name as a table
+// that was uploaded for the server are left out.
+func (bot *Bot) serverTables(context MessageContext) []Table {
+	var tables []Table
+	seen := make(map[string]bool)
+	for _, table := range bot.allTables(context) {
+		if name := strings.ToLower(table.Name); !seen[name] {
+			seen[name] = true
+			tables = append(tables, table)
+		}
+	}
+	sort.SliceStable(tables, func(i, j int) bool {
+		return strings.ToLower(tables[i].Name) < strings.ToLower(tables[j].Name)
+	})
+	return tables
+}
+
+// ListTables lists the tables for a server.
+func (bot *Bot) ListTables(context MessageContext) string {
+	tables := bot.serverTables(context)
+	if len(tables) == 0 {
+		return "I don't know any tables."
+	}
+
+	s := "I know the following tables:\n"
+	for _, table := range tables {
+		s += " * " + EscapeMarkdown(table.Name)
+		if table.Description != "" {
+			s += ": " + EscapeMarkdown(table.Description)
+		}
+		s += "\n"
+	}
+	return s
+}
+
+var nestedTable = regexp.MustCompile(`\{table:([^{}]+)\}`)
+
+// rollTable rolls on a table. It returns the text of the entry with its rolls and nested
+// tables filled in, and explanations of the rolls on nested tables and in the text.
+func (bot *Bot) rollTable(context MessageContext, state *tableRolls, table Table, depth int) (value int, explanation string, text string, rolls []string, err error) {
+	value, explanation, err = bot.roll(context, table.Roll)
+	if err != nil {
+		return
+	}
+	entry, found := table.entry(value)
+	if !found {
+		err = errors.New(fmt.Sprintf("table %s has no entry for %d", table.Name, value))
+		return
+	}
+
+	text, rolls = bot.fillTables(context, state, entry.Text, depth+1, func(input string) string { return input })
+	return
+}
+
+// fillTables rolls on the tables written as `{table:name}` in text, and rolls the rolls
+// written as `[[expr]]` after passing them through prepare.
+func (bot *Bot) fillTables(context MessageContext, state *tableRolls, text string, depth int, prepare func(string) string) (string, []string) {
+	var rolls []string
+	text = nestedTable.ReplaceAllStringFunc(text, func(match string) string {
+		name := nestedTable.FindStringSubmatch(match)[1]
+		table, found := state.find(bot, context, name)
+		if !found {
+			rolls = append(rolls, bot.HandleError(match, errors.New("unknown table")))
+			return "**?**"
+		}
+		if depth > MaxTableDepth {
+			rolls = append(rolls, bot.HandleError(match, errors.New("too many nested tables")))
+			return "**?**"
+		}
+		if state.count >= MaxTableRolls {
+			rolls = append(rolls, bot.HandleError(match, errors.New("too many tables")))
+			return "**?**"
+		}
+		state.count++
+
+		value, explanation, nested, nestedRolls, err := bot.rollTable(context, state, table, depth)
+		if err != nil {
+			rolls = append(rolls, bot.HandleError(table.Roll, err))
+			return "**?**"
+		}
+		rolls = append(rolls, EscapeMarkdown(table.Name)+": "+bot.FormatResult(table.Roll, value, explanation))
+		rolls = append(rolls, nestedRolls...)
+		return nested
+	})
+
+	text, inline := bot.rollInline(context, text, prepare)
+	return text, append(rolls, inline...)
+}
+
+// RollTable rolls on the table with a name, and shows the roll and the selected entry.
+func (bot *Bot) RollTable(context MessageContext, name string) Response {
+	table, found := bot.findTable(context, name)
+	if !found {
+		return Response{Content: bot.HandleError("table "+name, errors.New("unknown table"))}
+	}
+
+	embed := &Embed{Title: truncate(fmt.Sprintf("%s rolls on %s!", context.UserName, table.Name), MaxTitleLength)}
+	embed.setDescription(table.Description)
+	response := Response{Embed: embed, ReplyTo: context.MessageId}
+
+	value, explanation, text, rolls, err := bot.rollTable(context, &tableRolls{}, table, 0)
+	if err != nil {
+		embed.addField("Error", bot.HandleError(table.Roll, err), false)
+		return response
+	}
+	embed.addField("Roll", bot.FormatResult(table.Roll, value, explanation), false)
+	if text != "" {
+		embed.addField("Result", text, false)
+	}
+	if len(rolls) > 0 {
+		embed.addField("Rolls", strings.Join(rolls, "\n"), false)
+	}
+	return response
+}
+
+// loadedTableSet returns whether a table file was loaded, rather than uploaded.
+func (bot *Bot) loadedTableSet(set string) bool {
+	bot.tablesMutex.RLock()
+	defer bot.tablesMutex.RUnlock()
+
+	for _, table := range bot.tables {
+		if table.Set == set {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadTables stores a table file for the server a message was sent on. The format depends
+// on the extension of the filename.
+func (bot *Bot) UploadTables(context MessageContext, filename, content string) error {
+	return bot.upload(context, tableUploads, filename, content)
+}
+
+// RemoveTables removes a table file that was uploaded for a server.
+func (bot *Bot) RemoveTables(context MessageContext, set string) error {
+	return bot.removeUpload(context, tableUploads, set)
+}
+
+// tableChoices returns the tables whose name contains value. Names that start with value come
+// first.
+func tableChoices(bot *Bot, context MessageContext, value string) []Choice {
+	var names []string
+	for _, table := range bot.serverTables(context) {
+		names = append(names, table.Name)
+	}
+	return nameChoices(names, value)
+}
+
+func tableHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	action, value := args["action"], strings.TrimSpace(args["value"])
+	text := strings.TrimSpace("table " + action + " " + value)
+	// Tables whose name starts with "upload" or "remove" are rolled on, unless there is a file
+	// to upload or remove.
+	name := strings.TrimSpace(action + " " + value)
+	if args["name"] != "" {
+		name = args["name"]
+	}
+
+	switch action {
+	case "":
+		if name == "" {
+			return reply(bot.ListTables(context))
+		}
+		return Responses{bot.RollTable(context, name)}
+	case "remove":
+		if _, uploaded := bot.uploadedFile(context, tableUploads, value); !uploaded {
+			if _, found := bot.findTable(context, name); found {
+				return Responses{bot.RollTable(context, name)}
+			}
+		}
+		if err := bot.RemoveTables(context, value); err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		return reply(fmt.Sprintf("Removed table file `%s`", value))
+	}
+
+	// Table files are uploaded as attachments, or as the name of the file followed by JSON.
+	files, err := context.attachments()
+	if err != nil {
+		return reply(bot.HandleError(text, err))
+	}
+	if filename, content := splitCommand(value); content != "" {
+		files = []Attachment{{Name: filename + ".json", Content: content}}
+	}
+	if len(files) == 0 {
+		if _, found := bot.findTable(context, name); found {
+			return Responses{bot.RollTable(context, name)}
+		}
+		return reply(bot.HandleError(text, errors.New("attach a table file, or type `!table upload <name> <json>`")))
+	}
+
+	var names []string
+	for _, file := range files {
+		if err := bot.UploadTables(context, file.Name, file.Content); err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		names = append(names, "`"+setName(file.Name)+"`")
+	}
+	return reply("Uploaded table file " + strings.Join(names, ", "))
+}
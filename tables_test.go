@@ -0,0 +1,266 @@
+package dicebot
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var botWithTables = &Bot{
+	db: &JsonDatabase{},
+	tables: map[string]Table{
+		"treasure:loot": {
+			Name:        "Loot",
+			Description: "What the monster was carrying.",
+			Roll:        "d100",
+			Entries: []TableEntry{
+				{Range: "1-5", Text: "A potion."},
+				{Range: "6-50", Text: "[[2d6]] gold coins."},
+				{Range: "51-95", Text: "A {table:gem}."},
+				{Range: "96+", Text: "A magic sword!"},
+			},
+			Set: "treasure",
+		},
+		"treasure:gem": {
+			Name:    "Gem",
+			Roll:    "d2",
+			Entries: []TableEntry{{Range: "1", Text: "ruby"}, {Range: "2", Text: "sapphire"}},
+			Set:     "treasure",
+		},
+		"treasure:loop": {
+			Name:    "Loop",
+			Roll:    "1",
+			Entries: []TableEntry{{Range: "1", Text: "{table:loop}"}},
+			Set:     "treasure",
+		},
+	},
+}
+
+func TestLoadTables(t *testing.T) {
+	yaml := `tables:
+  - name: Wild Magic
+    entries:
+      - text: You turn blue.
+      - text: You levitate.
+        weight: 2
+      - text: Roll [[d4]] times on this table.
+`
+
+	filename := WriteTempFile(t, "test*.yaml", yaml)
+	defer os.Remove(filename)
+
+	tables := make(map[string]Table)
+	if err := LoadTables(tables, filename); err != nil {
+		t.Fatalf("LoadTables(%v): %v", filename, err)
+	}
+
+	expected := Table{
+		Name: "Wild Magic",
+		Roll: "d4",
+		Entries: []TableEntry{
+			{Range: "1", Text: "You turn blue."},
+			{Range: "2-3", Weight: 2, Text: "You levitate."},
+			{Range: "4", Text: "Roll [[d4]] times on this table."},
+		},
+		Set: setName(filename),
+	}
+	if !reflect.DeepEqual(tables, map[string]Table{expected.Set + ":wild magic": expected}) {
+		t.Errorf("LoadTables(): expected %+v got %+v", expected, tables)
+	}
+}
+
+func TestLoadTables_invalid(t *testing.T) {
+	tests := []string{
+		`[{"name": "Table"}]`,
+		`[{"entries": [{"text": "Nothing"}]}]`,
+		`[{"name": "Table", "roll": "d6", "entries": [{"range": "1-3"}, {"text": "Nothing"}]}]`,
+		`[{"name": "Table", "roll": "d6", "entries": [{"range": "lots"}]}]`,
+		`[{"name": "Table", "roll": "d6+", "entries": [{"range": "1-6"}]}]`,
+		`[{"name": "Table", "entries": [{"text": "[[d6+]]"}]}]`,
+	}
+
+	for _, test := range tests {
+		if _, err := parseTables("test.json", []byte(test)); err == nil {
+			t.Errorf("parseTables(%v) should fail", test)
+		}
+	}
+}
+
+func ExampleBot_RollTable() {
+	rand.Seed(1)
+
+	fmt.Println(botWithTables.RollTable(context, "loot"))
+	fmt.Println(botWithTables.RollTable(context, "loot"))
+	fmt.Println(botWithTables.RollTable(context, "loop"))
+	fmt.Println(botWithTables.RollTable(context, "unknown"))
+	// Output:
+	// Player rolls on Loot!
+	// What the monster was carrying.
+	// d100 => **82**
+	// A sapphire.
+	// Gem: d2 => **2**
+	// Player rolls on Loot!
+	// What the monster was carrying.
+	// d100 => **48**
+	// **8** gold coins.
+	// 2d6 => **(6 + 2)** => **8**
+	// Player rolls on Loop!
+	// 1 => **1**
+	// **?**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Loop: 1 => **1**
+	// Sorry, I don't understand how to parse '{table:loop}': too many nested tables
+	// Sorry, I don't understand how to parse 'table unknown': unknown table
+}
+
+func ExampleBot_HandleMessage_table() {
+	bot := &Bot{db: &JsonDatabase{}, permissions: DefaultPermissions(), tables: botWithTables.tables}
+	admin := context
+	admin.Permissions = PermissionManageGuild
+
+	fmt.Println(bot.HandleMessage(context, "!table"))
+	fmt.Println(bot.HandleMessage(context, `!table upload homebrew [{"name": "Gem", "entries": [{"text": "diamond"}]}]`))
+	fmt.Println(bot.HandleMessage(admin, `!table upload homebrew [{"name": "Gem", "entries": [{"text": "diamond"}]}]`))
+	fmt.Println(bot.HandleMessage(context, "!table gem"))
+	fmt.Println(bot.HandleMessage(admin, "!table remove homebrew"))
+	fmt.Println(bot.HandleMessage(admin, "!table remove homebrew"))
+	// Output:
+	// I know the following tables:
+	//  * Gem
+	//  * Loop
+	//  * Loot: What the monster was carrying.
+	//
+	// Sorry, you don't have permission to change the configuration
+	// Uploaded table file `homebrew`
+	// Player rolls on Gem!
+	// d1 => **1**
+	// diamond
+	// Removed table file `homebrew`
+	// Sorry, I don't understand how to parse 'table remove homebrew': no table file `homebrew` was uploaded
+}
+
+func ExampleBot_Autocomplete_table() {
+	fmt.Println(botWithTables.Autocomplete(context, "table", "name", "o"))
+	// Output:
+	// [{Loop Loop} {Loot Loot}]
+}
+
+func ExampleBot_MakeMove_table() {
+	rand.Seed(1)
+
+	bot := &Bot{
+		db:     &JsonDatabase{},
+		moves:  map[string]Move{"loot": {Name: "Loot", Roll: "2d6", Hit: "You find a {table:gem}."}},
+		tables: botWithTables.tables,
+	}
+
+	fmt.Println(bot.MakeMove(context, "loot"))
+	// Output:
+	// Player makes a move: Loot!
+	// 2d6 => **(6 + 4)** => **10**
+	// You find a sapphire.
+	// Gem: d2 => **2**
+}
+
+func ExampleBot_UploadTables() {
+	bot := &Bot{
+		db:          &JsonDatabase{},
+		permissions: DefaultPermissions(),
+		limits:      Limits{Variables: map[string]int{"tables": 2}},
+		tables:      botWithTables.tables,
+	}
+	admin := context
+	admin.Permissions = PermissionManageGuild
+
+	fmt.Println(bot.HandleMessage(admin, `!table upload homebrew [{"name": "Gem", "entries": [{"text": "diamond"}]}]`))
+	fmt.Println(bot.HandleMessage(admin, `!table upload treasure [{"name": "Gem", "entries": [{"text": "opal"}]}]`))
+	fmt.Println(bot.HandleMessage(admin, `!table upload extra [{"name": "Gem", "entries": [{"text": "opal"}]}]`))
+	fmt.Println(bot.HandleMessage(admin, `!table upload more [{"name": "Gem", "entries": [{"text": "pearl"}]}]`))
+	fmt.Println(bot.HandleMessage(admin, `!table upload homebrew [{"name": "Gem", "entries": [{"text": "emerald"}]}]`))
+	fmt.Println(bot.HandleMessage(admin, "!table gem"))
+	// Output:
+	// Uploaded table file `homebrew`
+	// Sorry, I don't understand how to parse 'table upload treasure [{"name": "Gem", "entries": [{"text": "opal"}]}]': there already is a table file `treasure`
+	// Uploaded table file `extra`
+	// Sorry, you can't upload more than 2 table files
+	// Uploaded table file `homebrew`
+	// Player rolls on Gem!
+	// d1 => **1**
+	// opal
+}
+
+func TestBot_UploadTables_noHistory(t *testing.T) {
+	bot := &Bot{db: &JsonDatabase{}}
+	for _, content := range []string{`[{"name": "A", "entries": [{"text": "a"}]}]`, `[{"name": "B", "entries": [{"text": "b"}]}]`} {
+		if err := bot.UploadTables(context, "homebrew.json", content); err != nil {
+			t.Fatalf("UploadTables(): %v", err)
+		}
+	}
+	if history := bot.db.ReadHistory("homebrew.json", context.tablesScope()); len(history) != 1 {
+		t.Errorf("UploadTables() should not keep old versions, got %+v", history)
+	}
+	if tables := bot.uploadedTables(context); len(tables) != 1 || tables[0].Name != "B" {
+		t.Errorf("uploadedTables() should return the new tables, got %+v", tables)
+	}
+	if err := bot.UploadTables(context, "homebrew.yaml", "- name: C\n  entries: [{text: c}]\n"); err == nil {
+		t.Errorf("UploadTables() should not upload the same table file twice")
+	}
+}
+
+func TestBot_RollTable_budget(t *testing.T) {
+	bot := &Bot{
+		db: &JsonDatabase{},
+		tables: map[string]Table{"test:a": {
+			Name:    "A",
+			Roll:    "1",
+			Entries: []TableEntry{{Range: "1", Text: strings.Repeat("{table:a}", 5)}},
+			Set:     "test",
+		}},
+	}
+
+	embed := bot.RollTable(context, "a").Embed
+	for _, field := range embed.Fields {
+		if field.Name == "Rolls" && strings.Count(field.Value, "A: 1") > MaxTableRolls {
+			t.Errorf("RollTable() rolled on more than %d tables", MaxTableRolls)
+		}
+		if n := len([]rune(field.Value)); n > MaxFieldLength {
+			t.Errorf("RollTable(): field %s has %d characters", field.Name, n)
+		}
+	}
+}
+
+func ExampleBot_HandleMessage_tableActionNames() {
+	rand.Seed(1)
+
+	bot := &Bot{
+		db:          &JsonDatabase{},
+		permissions: DefaultPermissions(),
+		tables: map[string]Table{
+			"spells:remove curse": {Name: "Remove Curse", Roll: "1", Entries: []TableEntry{{Range: "1", Text: "The curse is lifted."}}, Set: "spells"},
+			"spells:upload":       {Name: "Upload", Roll: "1", Entries: []TableEntry{{Range: "1", Text: "Your mind is uploaded."}}, Set: "spells"},
+		},
+	}
+
+	fmt.Println(bot.HandleMessage(context, "!table remove curse"))
+	fmt.Println(bot.HandleMessage(context, "!table upload"))
+	fmt.Println(bot.HandleMessage(context, "!table remove homebrew"))
+	// Output:
+	// Player rolls on Remove Curse!
+	// 1 => **1**
+	// The curse is lifted.
+	// Player rolls on Upload!
+	// 1 => **1**
+	// Your mind is uploaded.
+	// Sorry, you don't have permission to change the configuration
+}
@@ -0,0 +1,154 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxUploadSize is the size of the largest move or table file that can be uploaded.
+const MaxUploadSize = 100000
+
+// uploadKind is a kind of file that can be uploaded for a server, like move sets and tables.
+type uploadKind struct {
+	// name and files are how a file and files are called in messages, like "move set" and
+	// "move files". limit is the name of the limit on the number of files.
+	name  string
+	files string
+	limit string
+	scope func(context MessageContext) string
+	// parse parses a file, which is cached by uploaded.
+	parse func(filename string, data []byte) (interface{}, error)
+	// loaded returns whether a set with the name was loaded from a file, rather than uploaded.
+	loaded func(bot *Bot, set string) bool
+}
+
+var moveUploads = uploadKind{
+	name:  "move set",
+	files: "move files",
+	limit: "moves",
+	scope: MessageContext.movesScope,
+	parse: func(filename string, data []byte) (interface{}, error) {
+		return parseMoves(filename, data)
+	},
+	loaded: (*Bot).loadedSet,
+}
+
+var tableUploads = uploadKind{
+	name:  "table file",
+	files: "table files",
+	limit: "tables",
+	scope: MessageContext.tablesScope,
+	parse: func(filename string, data []byte) (interface{}, error) {
+		return parseTables(filename, data)
+	},
+	loaded: (*Bot).loadedTableSet,
+}
+
+// uploaded returns the parsed files of a kind uploaded for a server. Files are parsed once,
+// and cached until a file is uploaded or removed.
+func (bot *Bot) uploaded(context MessageContext, kind uploadKind) []interface{} {
+	scope := kind.scope(context)
+	bot.uploadsMutex.Lock()
+	defer bot.uploadsMutex.Unlock()
+
+	if files, found := bot.uploads[scope]; found {
+		return files
+	}
+
+	files := []interface{}{}
+	for _, filename := range bot.db.ListValues(scope) {
+		data, _ := bot.db.ReadValue(filename, scope)
+		// Files are checked when they are uploaded, so this should not fail.
+		if file, err := kind.parse(filename, []byte(data)); err == nil {
+			files = append(files, file)
+		}
+	}
+	if bot.uploads == nil {
+		bot.uploads = make(map[string][]interface{})
+	}
+	bot.uploads[scope] = files
+	return files
+}
+
+// forgetUploaded clears the cached files of a server, after a file was uploaded or removed.
+func (bot *Bot) forgetUploaded(context MessageContext, kind uploadKind) {
+	bot.uploadsMutex.Lock()
+	defer bot.uploadsMutex.Unlock()
+
+	delete(bot.uploads, kind.scope(context))
+}
+
+// uploadedFile returns the filename of the file of a set that was uploaded for a server.
+func (bot *Bot) uploadedFile(context MessageContext, kind uploadKind, set string) (string, bool) {
+	for _, filename := range bot.db.ListValues(kind.scope(context)) {
+		if setName(filename) == strings.ToLower(set) {
+			return filename, true
+		}
+	}
+	return "", false
+}
+
+// upload stores a file for the server a message was sent on. The format depends on the
+// extension of the filename. Uploading a file with the same name replaces it. Older versions
+// are not kept, because the files are large.
+func (bot *Bot) upload(context MessageContext, kind uploadKind, filename, content string) error {
+	if err := bot.checkRule(context, "config", "change the configuration"); err != nil {
+		return err
+	}
+	if len(content) > MaxUploadSize {
+		return errors.New(fmt.Sprintf("%s can't be larger than %d bytes", kind.files, MaxUploadSize))
+	}
+	if _, err := kind.parse(filename, []byte(content)); err != nil {
+		return err
+	}
+
+	scope := kind.scope(context)
+	filename, set := strings.ToLower(filename), setName(filename)
+	if kind.loaded(bot, set) {
+		return errors.New(fmt.Sprintf("there already is a %s `%s`", kind.name, set))
+	}
+	if existing, found := bot.uploadedFile(context, kind, set); found && existing != filename {
+		return errors.New(fmt.Sprintf("%s `%s` was already uploaded as `%s`", kind.name, set, existing))
+	}
+	if err := bot.checkQuota(filename, scope); err != nil {
+		return LimitError{fmt.Sprintf("you can't upload more than %d %s", bot.limits.Variables[kind.limit], kind.files)}
+	}
+
+	defer bot.forgetUploaded(context, kind)
+	if err := bot.db.DeleteValue(filename, scope); err != nil {
+		return err
+	}
+	return bot.db.StoreValue(filename, scope, content)
+}
+
+// removeUpload removes a file that was uploaded for a server.
+func (bot *Bot) removeUpload(context MessageContext, kind uploadKind, set string) error {
+	if err := bot.checkRule(context, "config", "change the configuration"); err != nil {
+		return err
+	}
+
+	if filename, found := bot.uploadedFile(context, kind, set); found {
+		defer bot.forgetUploaded(context, kind)
+		return bot.db.DeleteValue(filename, kind.scope(context))
+	}
+	return errors.New(fmt.Sprintf("no %s `%s` was uploaded", kind.name, set))
+}
+
+// nameChoices returns the names that contain value as choices. Names that start with value
+// come first.
+func nameChoices(names []string, value string) []Choice {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	var prefixed, contained []Choice
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		choice := Choice{Name: name, Value: name}
+		if strings.HasPrefix(lower, value) {
+			prefixed = append(prefixed, choice)
+		} else if strings.Contains(lower, value) {
+			contained = append(contained, choice)
+		}
+	}
+	return append(prefixed, contained...)
+}
@@ -0,0 +1,11 @@
+package dicebot
+
+import "fmt"
+
+func Example_nameChoices() {
+	fmt.Println(nameChoices([]string{"Defy Danger", "Hack and Slash", "Discern Realities", "Spout Lore"}, "d"))
+	fmt.Println(nameChoices([]string{"Defy Danger", "Hack and Slash"}, " SLASH "))
+	// Output:
+	// [{Defy Danger Defy Danger} {Discern Realities Discern Realities} {Hack and Slash Hack and Slash}]
+	// [{Hack and Slash Hack and Slash}]
+}
@@ -0,0 +1,161 @@
+package dicebot
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxXP is the largest amount of XP that can be awarded or spent at once.
+const MaxXP = 1000
+
+func parseLevels(context MessageContext, value string) (string, error) {
+	if value == "none" {
+		return value, nil
+	}
+
+	previous := 0
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= previous {
+			return "", errors.New("the value must be `none` or increasing amounts of XP, like `8,17,27`")
+		}
+		previous = n
+	}
+	return strings.ReplaceAll(value, " ", ""), nil
+}
+
+// level returns the level for an amount of XP, using the "xp-levels" setting. It returns zero
+// if no levels are set.
+func (bot *Bot) level(context MessageContext, xp int) int {
+	setting := bot.Setting(context, "xp-levels")
+	if setting == "none" {
+		return 0
+	}
+
+	level := 1
+	for _, part := range strings.Split(setting, ",") {
+		if n, _ := strconv.Atoi(part); xp >= n {
+			level += 1
+		}
+	}
+	return level
+}
+
+// XP returns the XP of a user on a server. It is kept with the hold and bonuses of the user.
+func (bot *Bot) XP(context MessageContext) int {
+	return bot.stateValue(context, "xp")
+}
+
+// AddXP changes the XP of a user, and returns a description of the new XP.
+func (bot *Bot) AddXP(context MessageContext, amount int) (string, error) {
+	before := bot.XP(context)
+	xp := before + amount
+	if xp < 0 {
+		return "", errors.New(fmt.Sprintf("you only have %d XP", before))
+	}
+
+	// The name is stored for XPTable, which only knows the IDs of users. It is unknown when
+	// the GM awards XP to a user ID instead of a mention.
+	if context.UserName != "" {
+		if err := bot.db.StoreValue("name", context.stateScope(), context.UserName); err != nil {
+			return "", err
+		}
+	}
+	if err := bot.db.StoreValue("xp", context.stateScope(), strconv.Itoa(xp)); err != nil {
+		return "", err
+	}
+
+	s := bot.formatXP(context, xp)
+	if level := bot.level(context, xp); level > bot.level(context, before) {
+		s += fmt.Sprintf(" You can level up to level %d!", level)
+	}
+	return s, nil
+}
+
+func (bot *Bot) formatXP(context MessageContext, xp int) string {
+	s := fmt.Sprintf("You have %d XP.", xp)
+	if level := bot.level(context, xp); level > 0 {
+		s = fmt.Sprintf("You have %d XP (level %d).", xp, level)
+	}
+	return s
+}
+
+// XPTable shows the XP of everybody on the server.
+func (bot *Bot) XPTable(context MessageContext) string {
+	type player struct {
+		name string
+		xp   int
+	}
+
+	var players []player
+	suffix := "-server-" + context.ServerId
+	for _, scope := range bot.db.ListScopes("state-user-") {
+		if !strings.HasSuffix(scope, suffix) {
+			continue
+		}
+		value, found := bot.db.ReadValue("xp", scope)
+		if !found {
+			continue
+		}
+		name, found := bot.db.ReadValue("name", scope)
+		if !found {
+			name = "<@" + strings.TrimSuffix(strings.TrimPrefix(scope, "state-user-"), suffix) + ">"
+		}
+		xp, _ := strconv.Atoi(value)
+		players = append(players, player{name, xp})
+	}
+	if len(players) == 0 {
+		return "Nobody has any XP yet."
+	}
+
+	sort.Slice(players, func(i, j int) bool {
+		if players[i].xp != players[j].xp {
+			return players[i].xp > players[j].xp
+		}
+		return players[i].name < players[j].name
+	})
+
+	s := "XP on this server:\n"
+	for _, player := range players {
+		s += fmt.Sprintf(" * %s: %d XP", EscapeMarkdown(player.name), player.xp)
+		if level := bot.level(context, player.xp); level > 0 {
+			s += fmt.Sprintf(" (level %d)", level)
+		}
+		s += "\n"
+	}
+	return s
+}
+
+func xpHandler(bot *Bot, context MessageContext, args map[string]string) Responses {
+	text := strings.TrimSpace("xp " + args["amount"] + " " + args["user"])
+	target, err := targetUser(context, args["user"])
+	if err != nil {
+		return reply(bot.HandleError(text, err))
+	}
+
+	switch amount := args["amount"]; amount {
+	case "":
+		return reply(addressed(context, target, bot.formatXP(target, bot.XP(target))))
+	case "table":
+		return reply(bot.XPTable(context))
+	default:
+		n, err := strconv.Atoi(amount)
+		if err != nil || n == 0 || n > MaxXP || n < -MaxXP {
+			return reply(bot.HandleError(text, errors.New(fmt.Sprintf("the XP must be between -%d and %d, and not 0", MaxXP, MaxXP))))
+		}
+		// Players mark and spend their own XP, but only the GM can change the XP of others.
+		if target.UserId != context.UserId {
+			if err := bot.checkGM(context, "change the XP of somebody else"); err != nil {
+				return reply(bot.HandleError(text, err))
+			}
+		}
+		response, err := bot.AddXP(target, n)
+		if err != nil {
+			return reply(bot.HandleError(text, err))
+		}
+		return reply(addressed(context, target, response))
+	}
+}
@@ -0,0 +1,64 @@
+package dicebot
+
+import "fmt"
+
+func ExampleBot_AddXP() {
+	bot := &Bot{db: &JsonDatabase{}}
+	admin := context
+	admin.Permissions = PermissionManageGuild
+	other := context
+	other.UserId, other.UserName = "other", "Other"
+
+	fmt.Println(bot.HandleMessage(context, "!xp"))
+	fmt.Println(bot.HandleMessage(context, "!xp table"))
+	fmt.Println(bot.HandleMessage(context, "!xp +7"))
+	fmt.Println(bot.HandleMessage(context, "!xp -8"))
+	fmt.Println(bot.HandleMessage(admin, "!config xp-levels 8, 17, 27"))
+	fmt.Println(bot.HandleMessage(admin, "!config xp-levels 8,3"))
+	fmt.Println(bot.HandleMessage(context, "!xp +1"))
+	fmt.Println(bot.HandleMessage(other, "!xp 2"))
+	fmt.Println(bot.HandleMessage(other, "!xp table"))
+	// Output:
+	// You have 0 XP.
+	// Nobody has any XP yet.
+	// You have 7 XP.
+	// Sorry, I don't understand how to parse 'xp -8': you only have 7 XP
+	// Changed xp-levels to `8,17,27`
+	// Sorry, I don't understand how to parse 'config xp-levels 8,3': the value must be `none` or increasing amounts of XP, like `8,17,27`
+	// You have 8 XP (level 2). You can level up to level 2!
+	// You have 2 XP (level 1).
+	// XP on this server:
+	//  * Player: 8 XP (level 2)
+	//  * Other: 2 XP (level 1)
+}
+
+func ExampleBot_AddXP_permissions() {
+	bot := &Bot{db: &JsonDatabase{}, permissions: DefaultPermissions()}
+	gm := context
+	gm.UserId, gm.UserName, gm.Permissions = "gm", "GM", PermissionManageChannels
+	gm.Mentions = map[string]string{"@Player": "user"}
+	player := context
+	player.Mentions = map[string]string{"@GM": "gm"}
+
+	fmt.Println(bot.HandleMessage(player, "!xp +1"))
+	fmt.Println(bot.HandleMessage(player, "!xp +5 @GM"))
+	fmt.Println(bot.HandleMessage(gm, "!xp 99999999999999999999 @Player"))
+	fmt.Println(bot.HandleMessage(gm, "!xp 0 @Player"))
+	fmt.Println(bot.HandleMessage(gm, "!xp +5 @Player"))
+	fmt.Println(bot.HandleMessage(gm, "!xp +1 <@123>"))
+	fmt.Println(bot.HandleMessage(player, "!xp -2"))
+	fmt.Println(bot.HandleMessage(gm, "!xp"))
+	fmt.Println(bot.HandleMessage(gm, "!xp table"))
+	// Output:
+	// You have 1 XP.
+	// Sorry, you don't have permission to change the XP of somebody else
+	// Sorry, I don't understand how to parse 'xp 99999999999999999999 @Player': the XP must be between -1000 and 1000, and not 0
+	// Sorry, I don't understand how to parse 'xp 0 @Player': the XP must be between -1000 and 1000, and not 0
+	// <@user> You have 6 XP.
+	// <@123> You have 1 XP.
+	// You have 4 XP.
+	// You have 0 XP.
+	// XP on this server:
+	//  * Player: 4 XP
+	//  * <@123>: 1 XP
+}